@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/norlis/httpgate/pkg/adapter/apidriven/routes"
+	"github.com/norlis/httpgate/pkg/application/coverage"
+)
+
+func coverageCmd(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	var opaf opaFlags
+	fs := newFlagSet("coverage", "", stderr)
+	opaf.register(fs)
+	routesFile := fs.String("routes", "", "archivo con un patrón de ServeMux por línea, p.ej. \"GET /api/items/{id}\", o la url del inventario de routes.Registry")
+	asJSON := fs.Bool("json", false, "imprime el reporte completo en JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *routesFile == "" {
+		fs.Usage()
+		return fmt.Errorf("falta -routes")
+	}
+
+	registered, err := readRoutes(ctx, *routesFile)
+	if err != nil {
+		return err
+	}
+
+	client, err := opaf.client(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	rules, err := coverage.LoadRules(ctx, client)
+	if err != nil {
+		return err
+	}
+	report, err := coverage.Check(registered, rules)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		if err := writeJSON(stdout, report); err != nil {
+			return err
+		}
+	} else {
+		printReport(stdout, report)
+	}
+
+	if len(report.Uncovered) > 0 {
+		return errFailed
+	}
+	return nil
+}
+
+// readRoutes lee un patrón por línea; las líneas vacías y las que empiezan con
+// # se ignoran. Si path es una url se consulta el inventario de un
+// routes.Registry (Registry.Handler).
+func readRoutes(ctx context.Context, path string) ([]coverage.Route, error) {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return fetchRoutes(ctx, path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var result []coverage.Route
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		result = append(result, coverage.ParseRoute(line))
+	}
+	return result, scanner.Err()
+}
+
+func printReport(w io.Writer, report coverage.Report) {
+	fmt.Fprintf(w, "%d rutas, %d sin cubrir\n", len(report.Routes), len(report.Uncovered))
+	for _, rc := range report.Routes {
+		if rc.Covered() {
+			continue
+		}
+		fmt.Fprintf(w, "  sin cubrir: %s", rc.Route)
+		if len(rc.Permissions) > 0 {
+			fmt.Fprintf(w, " (permisos sin rol: %s)", strings.Join(rc.Permissions, ", "))
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(report.UnusedPatterns) > 0 {
+		fmt.Fprintf(w, "%d expresiones sin ruta\n", len(report.UnusedPatterns))
+		for _, p := range report.UnusedPatterns {
+			owner := p.Permission
+			if owner == "" {
+				owner = "data.whitelist"
+			}
+			fmt.Fprintf(w, "  %s: %s\n", owner, p.Pattern)
+		}
+	}
+}
+
+func fetchRoutes(ctx context.Context, url string) ([]coverage.Route, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s respondió %d", url, resp.StatusCode)
+	}
+
+	var inventory routes.Inventory
+	if err := json.NewDecoder(resp.Body).Decode(&inventory); err != nil {
+		return nil, fmt.Errorf("inventario de rutas inválido en %s: %w", url, err)
+	}
+
+	result := make([]coverage.Route, len(inventory.Routes))
+	for i, pattern := range inventory.Routes {
+		result[i] = coverage.ParseRoute(pattern)
+		result[i].Requires = inventory.Requirements[pattern].Permissions
+		result[i].Query = inventory.Requirements[pattern].Query
+	}
+	return result, nil
+}
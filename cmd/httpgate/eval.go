@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/norlis/httpgate/pkg/domain"
+	"github.com/norlis/httpgate/pkg/kit/authztest"
+)
+
+// headerFlags acumula las cabeceras de -H "Nombre: valor".
+type headerFlags map[string]string
+
+func (h headerFlags) String() string { return "" }
+
+func (h headerFlags) Set(value string) error {
+	name, v, ok := strings.Cut(value, ":")
+	if !ok {
+		return fmt.Errorf("cabecera inválida %q, se espera \"Nombre: valor\"", value)
+	}
+	h[strings.TrimSpace(name)] = strings.TrimSpace(v)
+	return nil
+}
+
+type evalOutput struct {
+	Allow    bool               `json:"allow"`
+	Status   int                `json:"status"`
+	Input    domain.PolicyInput `json:"input"`
+	Decision domain.Decision    `json:"decision"`
+}
+
+func eval(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	var opaf opaFlags
+	headers := headerFlags{}
+	fs := newFlagSet("eval", "METODO /ruta", stderr)
+	opaf.register(fs)
+	payload := fs.String("payload", "{}", "payload del principal en JSON, o @archivo")
+	explain := fs.Bool("explain", false, "incluye la traza de las reglas que fallaron")
+	fs.Var(headers, "H", "cabecera de la petición \"Nombre: valor\", se puede repetir")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := parseRequest(fs.Args())
+	if err != nil {
+		fs.Usage()
+		return err
+	}
+	c.Headers = headers
+	if c.Payload, err = parsePayload(*payload); err != nil {
+		return err
+	}
+
+	cfg, err := opaf.load()
+	if err != nil {
+		return err
+	}
+	h, err := authztest.New(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	r := h.Run([]authztest.Case{c})[0]
+	if r.Err != nil {
+		return r.Err
+	}
+	if !*explain {
+		r.Decision.Explanation = nil
+	}
+
+	return writeJSON(stdout, evalOutput{Allow: r.Allowed, Status: r.Status, Input: r.Input, Decision: r.Decision})
+}
+
+// parseRequest acepta "GET /ruta", "GET:/ruta" o "/ruta" (GET).
+func parseRequest(args []string) (authztest.Case, error) {
+	switch len(args) {
+	case 1:
+		if method, path, ok := strings.Cut(args[0], ":"); ok && strings.HasPrefix(path, "/") {
+			return authztest.Case{Method: method, URL: path}, nil
+		}
+		if strings.HasPrefix(args[0], "/") {
+			return authztest.Case{Method: http.MethodGet, URL: args[0]}, nil
+		}
+	case 2:
+		if strings.HasPrefix(args[1], "/") {
+			return authztest.Case{Method: args[0], URL: args[1]}, nil
+		}
+	}
+	return authztest.Case{}, fmt.Errorf("se espera la petición como \"METODO /ruta\"")
+}
+
+func parsePayload(value string) (map[string]any, error) {
+	raw := []byte(value)
+	if file, ok := strings.CutPrefix(value, "@"); ok {
+		var err error
+		if raw, err = os.ReadFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	var payload map[string]any
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, fmt.Errorf("payload inválido: %w", err)
+	}
+	return payload, nil
+}
@@ -0,0 +1,158 @@
+// Command httpgate valida y evalúa las políticas de autorización sin depender
+// del binario de opa:
+//
+//	httpgate validate -config httpgate.yaml
+//	httpgate eval -policies policies/authz -payload '{"roles":["admin"]}' GET /api/items/42
+//	httpgate coverage -policies policies/authz -routes routes.txt
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/norlis/httpgate/pkg/adapter/opa"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+const usage = `uso: httpgate <comando> [opciones]
+
+comandos:
+  validate   compila las políticas y carga los datos de la configuración
+  eval       evalúa una petición igual que AuthorizationMiddleware
+  coverage   informa las rutas que ningún permiso ni la whitelist cubren
+
+"httpgate <comando> -h" muestra las opciones de cada comando.
+`
+
+// errFailed indica que el comando terminó pero el resultado no es el esperado
+// (p.ej. rutas sin cubrir); ya se informó, solo cambia el código de salida.
+var errFailed = errors.New("failed")
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, errFailed) && !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "httpgate:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return flag.ErrHelp
+	}
+
+	commands := map[string]func(context.Context, []string, io.Writer, io.Writer) error{
+		"validate": validate,
+		"eval":     eval,
+		"coverage": coverageCmd,
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprint(stderr, usage)
+		return fmt.Errorf("comando desconocido: %s", args[0])
+	}
+	return cmd(ctx, args[1:], stdout, stderr)
+}
+
+// opaFlags son las opciones comunes para construir el opa.Config.
+type opaFlags struct {
+	config   string
+	policies string
+	query    string
+	data     string
+}
+
+func (f *opaFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.config, "config", "", "archivo YAML con la configuración de OPA (opa.Config)")
+	fs.StringVar(&f.policies, "policies", "", "directorio de políticas, reemplaza a policiesPath")
+	fs.StringVar(&f.query, "query", "", "consulta por defecto, reemplaza a query (data.authz.decision si no se define)")
+	fs.StringVar(&f.data, "data", "", "archivos de datos separados por coma, reemplazan a dataFiles")
+}
+
+func (f *opaFlags) load() (opa.Config, error) {
+	var cfg opa.Config
+	if f.config != "" {
+		raw, err := os.ReadFile(f.config)
+		if err != nil {
+			return cfg, err
+		}
+		if err := yaml.Unmarshal(raw, &cfg); err != nil {
+			return cfg, fmt.Errorf("configuración inválida en %s: %w", f.config, err)
+		}
+	}
+
+	if f.policies != "" {
+		cfg.PoliciesPath = f.policies
+	}
+	if f.query != "" {
+		cfg.Query = f.query
+	}
+	if cfg.Query == "" {
+		cfg.Query = "data.authz.decision"
+	}
+	if f.data != "" {
+		cfg.DataFiles = strings.Split(f.data, ",")
+	}
+	cfg.Watch = false
+	return cfg, nil
+}
+
+func (f *opaFlags) client(ctx context.Context) (*opa.SdkClient, error) {
+	cfg, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	return opa.NewOpaSdkClientFromConfig(ctx, cfg, zap.NewNop())
+}
+
+func newFlagSet(name, args string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "uso: httpgate %s [opciones] %s\n\nopciones:\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func validate(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	var opaf opaFlags
+	fs := newFlagSet("validate", "", stderr)
+	opaf.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := opaf.load()
+	if err != nil {
+		return err
+	}
+	client, err := opa.NewOpaSdkClientFromConfig(ctx, cfg, zap.NewNop())
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	fmt.Fprintf(stdout, "ok: revisión %s, consulta %s", client.Revision(), cfg.Query)
+	if len(cfg.Queries) > 0 {
+		fmt.Fprintf(stdout, " y %d consultas con nombre", len(cfg.Queries))
+	}
+	fmt.Fprintln(stdout)
+	return nil
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
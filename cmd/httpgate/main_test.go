@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/norlis/httpgate/pkg/adapter/apidriven/routes"
+)
+
+const policies = "../../policies/authz"
+
+func runCmd(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	err := run(context.Background(), args, &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func TestValidate(t *testing.T) {
+	out, err := runCmd(t, "validate", "-policies", policies)
+	if err != nil || !strings.HasPrefix(out, "ok: ") {
+		t.Errorf("validate = %q, %v", out, err)
+	}
+
+	if _, err := runCmd(t, "validate", "-policies", t.TempDir(), "-data", "missing.json"); err == nil {
+		t.Error("validate error = nil, want missing data file")
+	}
+}
+
+func TestEval(t *testing.T) {
+	out, err := runCmd(t, "eval", "-policies", policies, "-H", "X-Tenant: acme", "GET", "/api/test")
+	if err != nil {
+		t.Fatalf("eval error = %v", err)
+	}
+
+	var got evalOutput
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("eval output = %s: %v", out, err)
+	}
+	if !got.Allow || got.Input.Action != "GET:/api/test" || got.Decision.Explanation != nil {
+		t.Errorf("eval = %+v, want allowed GET:/api/test without explanation", got)
+	}
+
+	if _, err := runCmd(t, "eval", "-policies", policies, "api/test"); err == nil {
+		t.Error("eval error = nil, want invalid request")
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"authz.rego", "permissions.json", "whitelist.json"} {
+		raw, err := os.ReadFile(filepath.Join(policies, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), raw, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Sin el rol admin nadie otorga command.create.
+	if err := os.WriteFile(filepath.Join(dir, "roles.json"), []byte(`{"roles": {"anonymous": ["whitelist"]}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	routesFile := filepath.Join(t.TempDir(), "routes.txt")
+	if err := os.WriteFile(routesFile, []byte("# rutas\nGET /status\nPOST /command\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := runCmd(t, "coverage", "-policies", dir, "-routes", routesFile)
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("coverage error = %v, want errFailed", err)
+	}
+	if !strings.Contains(out, "sin cubrir: POST /command (permisos sin rol: command.create, super-admin)") {
+		t.Errorf("coverage = %s", out)
+	}
+
+	out, err = runCmd(t, "coverage", "-policies", policies, "-routes", routesFile)
+	if err != nil || !strings.HasPrefix(out, "2 rutas, 0 sin cubrir") {
+		t.Errorf("coverage = %q, %v", out, err)
+	}
+}
+
+func TestCoverage_FromRegistry(t *testing.T) {
+	registry := routes.NewRegistry(nil)
+	registry.HandleFunc("GET /status", func(http.ResponseWriter, *http.Request) {})
+	registry.HandleFunc("POST /command", func(http.ResponseWriter, *http.Request) {})
+	srv := httptest.NewServer(registry.Handler(nil))
+	defer srv.Close()
+
+	out, err := runCmd(t, "coverage", "-policies", policies, "-routes", srv.URL)
+	if err != nil || !strings.HasPrefix(out, "2 rutas, 0 sin cubrir") {
+		t.Errorf("coverage = %q, %v", out, err)
+	}
+}
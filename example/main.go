@@ -9,6 +9,9 @@ import (
 
 	"github.com/norlis/httpgate/pkg/adapter/apidriven/middleware"
 	"github.com/norlis/httpgate/pkg/adapter/apidriven/presenters"
+	"github.com/norlis/httpgate/pkg/adapter/apidriven/routes"
+	"github.com/norlis/httpgate/pkg/adapter/decisioncache"
+	"github.com/norlis/httpgate/pkg/adapter/decisionlog"
 	"github.com/norlis/httpgate/pkg/adapter/opa"
 	"github.com/norlis/httpgate/pkg/application/health"
 	"go.uber.org/fx"
@@ -38,9 +41,10 @@ func main() {
 		fx.Invoke(func(router *http.ServeMux, status *health.Status, logger *zap.Logger, render presenters.Presenters) {
 
 			opaConfig := opa.Config{
-				Query:        "data.authz.allow",
+				Query:        "data.authz.decision",
 				PoliciesPath: "policies/authz", // Directorio con authz.rego
 				DataFiles:    []string{},
+				Watch:        true,
 			}
 
 			authz, err := opa.NewOpaSdkClientFromConfig(context.Background(), opaConfig, logger)
@@ -49,6 +53,15 @@ func main() {
 				log.Fatalf("No se pudo inicializar el cliente OPA: %v", err)
 			}
 
+			decisions, err := decisionlog.New(
+				decisionlog.Config{Mask: []string{"/input/payload/token"}},
+				logger,
+				decisionlog.NewZapSink(logger),
+			)
+			if err != nil {
+				log.Fatalf("No se pudo inicializar el registro de decisiones: %v", err)
+			}
+
 			commons := []middleware.Middleware{
 				middleware.TraceId(middleware.WithHeaderName("X-Request-ID")),
 				middleware.APIErrorMiddleware(
@@ -66,7 +79,7 @@ func main() {
 				append(
 					commons,
 					[]middleware.Middleware{middleware.AuthorizationMiddleware(
-						authz,
+						decisionlog.NewEnforcer(decisioncache.NewEnforcer(authz, decisioncache.Config{}), decisions),
 						func(r *http.Request) (map[string]any, error) {
 							return map[string]any{"roles": []string{}}, nil
 						},
@@ -80,13 +93,19 @@ func main() {
 			//	httpmiddleware.Cors(),
 			//	httpmiddleware.AuthorizationMiddleware(authz),
 			//)
-			base := http.NewServeMux()
+			// Las rutas se registran en un routes.Registry para poder cruzarlas con los permisos.
+			base := routes.NewRegistry(nil)
 
 			base.Handle("GET /status", status)
 			base.Handle("GET /live", health.NewProbe(nil))
 			base.Handle("GET /ready", health.NewProbe(nil)) // listo para aceptar trafico
 
-			api := http.NewServeMux()
+			// Inventario de rutas y cobertura de permisos: expone la política, así
+			// que se sirve detrás de la autorización como cualquier ruta de /api.
+			admin := base.Group("/admin")
+			admin.Handle("GET /routes", base.Handler(authz))
+
+			api := base.Group("/api")
 			api.HandleFunc("GET /test", func(w http.ResponseWriter, r *http.Request) {
 				render.JSON(
 					w, r,
@@ -106,6 +125,7 @@ func main() {
 
 			router.Handle("/", public(base))
 			router.Handle("/api/", protected(http.StripPrefix("/api", api)))
+			router.Handle("/admin/", protected(http.StripPrefix("/admin", admin)))
 			//router.Handle("/api/", use(api))
 		}),
 	)
@@ -0,0 +1,254 @@
+package authn
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/norlis/httpgate/pkg/adapter/apidriven/middleware"
+)
+
+const (
+	defaultAPIKeyHeader = "X-API-Key"
+	apiKeyScheme        = "ApiKey"
+)
+
+// APIKeyRecord es una clave registrada en el almacén. Nunca se guarda la clave
+// en claro: solo el hash SHA-256 de salt+secreto, ambos en hexadecimal.
+type APIKeyRecord struct {
+	ID        string    `json:"id" yaml:"id"`
+	Owner     string    `json:"owner" yaml:"owner"`
+	Roles     []string  `json:"roles" yaml:"roles"`
+	Scopes    []string  `json:"scopes" yaml:"scopes"`
+	Salt      string    `json:"salt" yaml:"salt"`
+	Hash      string    `json:"hash" yaml:"hash"`
+	ExpiresAt time.Time `json:"expiresAt,omitzero" yaml:"expiresAt,omitempty"` // vacío si no expira
+	Revoked   bool      `json:"revoked,omitempty" yaml:"revoked,omitempty"`
+}
+
+// APIKeyStore resuelve una clave por su identificador.
+type APIKeyStore interface {
+	Lookup(ctx context.Context, id string) (APIKeyRecord, bool, error)
+}
+
+type APIKeyConfig struct {
+	Header     string `yaml:"header"`     // cabecera con la clave, por defecto X-API-Key
+	QueryParam string `yaml:"queryParam"` // parámetro alternativo de la query, deshabilitado si está vacío; se quita de la URL al leerlo
+	Realm      string `yaml:"realm"`      // se informa en WWW-Authenticate
+}
+
+// APIKey devuelve un extractor que valida claves con el formato "<id>.<secreto>"
+// contra el almacén y construye el payload con el dueño, roles y scopes:
+//
+//	{"roles": ["deployer"], "scopes": ["deploy"], "sub": "ci-pipeline", "keyId": "ci"}
+func APIKey(cfg APIKeyConfig, store APIKeyStore) (middleware.PayloadExtractor, error) {
+	if store == nil {
+		return nil, fmt.Errorf("el almacén de api keys no puede ser nulo")
+	}
+	if cfg.Header == "" {
+		cfg.Header = defaultAPIKeyHeader
+	}
+
+	v := &apiKeyVerifier{cfg: cfg, store: store, now: time.Now}
+	return v.extract, nil
+}
+
+type apiKeyVerifier struct {
+	cfg   APIKeyConfig
+	store APIKeyStore
+	now   func() time.Time
+}
+
+func (v *apiKeyVerifier) extract(r *http.Request) (map[string]any, error) {
+	key := r.Header.Get(v.cfg.Header)
+	if v.cfg.QueryParam != "" {
+		if fromQuery := stripQueryParam(r, v.cfg.QueryParam); key == "" {
+			key = fromQuery
+		}
+	}
+	if key == "" {
+		return nil, middleware.MissingCredentials(apiKeyScheme, v.cfg.Realm, "missing api key")
+	}
+
+	record, err := v.verify(r.Context(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"roles":  nonNil(record.Roles),
+		"scopes": nonNil(record.Scopes),
+		"sub":    record.Owner,
+		"keyId":  record.ID,
+	}, nil
+}
+
+// stripQueryParam devuelve el parámetro y lo quita de la petición, para que la
+// clave no llegue al input de la política, al registro de decisiones ni a los
+// logs.
+func stripQueryParam(r *http.Request, name string) string {
+	query := r.URL.Query()
+	if !query.Has(name) {
+		return ""
+	}
+
+	value := query.Get(name)
+	query.Del(name)
+	r.URL.RawQuery = query.Encode()
+	if r.RequestURI != "" {
+		r.RequestURI = r.URL.RequestURI()
+	}
+	return value
+}
+
+func (v *apiKeyVerifier) verify(ctx context.Context, key string) (APIKeyRecord, error) {
+	invalid := func(description string, err error) error {
+		return middleware.InvalidCredentials(apiKeyScheme, v.cfg.Realm, description, err)
+	}
+
+	id, secret, ok := splitAPIKey(key)
+	if !ok {
+		return APIKeyRecord{}, invalid("invalid api key", nil)
+	}
+
+	record, found, err := v.store.Lookup(ctx, id)
+	if err != nil {
+		// Un fallo del almacén no dice nada de la clave: no se responde 401.
+		return APIKeyRecord{}, middleware.AuthnUnavailable("api key could not be verified", err)
+	}
+	if !found {
+		// Se calcula igualmente un hash para no revelar por tiempo qué ids existen.
+		_ = matchAPIKey(APIKeyRecord{}, secret)
+		return APIKeyRecord{}, invalid("invalid api key", nil)
+	}
+
+	if !matchAPIKey(record, secret) {
+		return APIKeyRecord{}, invalid("invalid api key", nil)
+	}
+	if record.Revoked {
+		return APIKeyRecord{}, invalid("api key revoked", nil)
+	}
+	if !record.ExpiresAt.IsZero() && v.now().After(record.ExpiresAt) {
+		return APIKeyRecord{}, invalid("api key expired", nil)
+	}
+
+	return record, nil
+}
+
+// splitAPIKey separa "<id>.<secreto>". El secreto se genera en base64url, que
+// no contiene puntos, así que el id puede tenerlos.
+func splitAPIKey(key string) (id, secret string, ok bool) {
+	i := strings.LastIndexByte(key, '.')
+	if i <= 0 || i == len(key)-1 {
+		return "", "", false
+	}
+	return key[:i], key[i+1:], true
+}
+
+// matchAPIKey compara en tiempo constante el hash del secreto con el registrado.
+func matchAPIKey(record APIKeyRecord, secret string) bool {
+	want, err := hex.DecodeString(record.Hash)
+	if err != nil {
+		return false
+	}
+	got := hashAPIKey(record.Salt, secret)
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+func hashAPIKey(salt, secret string) []byte {
+	sum := sha256.Sum256([]byte(salt + secret))
+	return sum[:]
+}
+
+// NewAPIKey genera una clave nueva para el id indicado. Devuelve la clave que
+// se entrega al cliente (solo se conoce en este momento) y el registro a
+// guardar en el almacén, al que hay que completar dueño, roles y scopes.
+func NewAPIKey(id string) (string, APIKeyRecord, error) {
+	if id == "" || strings.ContainsAny(id, " \t") {
+		return "", APIKeyRecord{}, fmt.Errorf("id de api key inválido: %q", id)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", APIKeyRecord{}, err
+	}
+	rawSalt := make([]byte, 16)
+	if _, err := rand.Read(rawSalt); err != nil {
+		return "", APIKeyRecord{}, err
+	}
+
+	secret := base64.RawURLEncoding.EncodeToString(raw)
+	salt := hex.EncodeToString(rawSalt)
+
+	return id + "." + secret, APIKeyRecord{
+		ID:   id,
+		Salt: salt,
+		Hash: hex.EncodeToString(hashAPIKey(salt, secret)),
+	}, nil
+}
+
+// MemoryAPIKeyStore es un almacén en memoria, útil para pruebas y para claves
+// que se cargan desde la configuración.
+type MemoryAPIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]APIKeyRecord
+}
+
+func NewMemoryAPIKeyStore(records ...APIKeyRecord) *MemoryAPIKeyStore {
+	s := &MemoryAPIKeyStore{}
+	s.Replace(records)
+	return s
+}
+
+func (s *MemoryAPIKeyStore) Lookup(_ context.Context, id string) (APIKeyRecord, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.keys[id]
+	return record, ok, nil
+}
+
+// Put agrega o reemplaza una clave.
+func (s *MemoryAPIKeyStore) Put(record APIKeyRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[record.ID] = record
+}
+
+// Revoke marca la clave como revocada. Devuelve false si no existe.
+func (s *MemoryAPIKeyStore) Revoke(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.keys[id]
+	if ok {
+		record.Revoked = true
+		s.keys[id] = record
+	}
+	return ok
+}
+
+// Replace sustituye todas las claves de forma atómica.
+func (s *MemoryAPIKeyStore) Replace(records []APIKeyRecord) {
+	keys := make(map[string]APIKeyRecord, len(records))
+	for _, record := range records {
+		keys[record.ID] = record
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
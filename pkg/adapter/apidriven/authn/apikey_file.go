@@ -0,0 +1,124 @@
+package authn
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/norlis/httpgate/pkg/kit/fswatch"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// apiKeyFile es el formato del archivo de claves, en JSON o YAML según la extensión:
+//
+//	keys:
+//	  - id: ci
+//	    owner: ci-pipeline
+//	    roles: [deployer]
+//	    salt: 9f0c...
+//	    hash: 4be1...
+//	    expiresAt: 2027-01-01T00:00:00Z
+type apiKeyFile struct {
+	Keys []APIKeyRecord `json:"keys" yaml:"keys"`
+}
+
+// FileAPIKeyStore lee las claves desde un archivo JSON o YAML y lo vuelve a
+// leer cuando cambia algo en su directorio, lo que incluye los Secrets montados
+// por Kubernetes. Si el contenido no cambió no se recarga, y si la recarga
+// falla se mantienen las últimas claves válidas.
+type FileAPIKeyStore struct {
+	keys    *MemoryAPIKeyStore
+	path    string
+	watcher *fswatch.Watcher
+	logger  *zap.Logger
+
+	mu  sync.Mutex
+	sum [sha256.Size]byte // hash del último contenido cargado
+}
+
+func NewFileAPIKeyStore(path string, logger *zap.Logger) (*FileAPIKeyStore, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	s := &FileAPIKeyStore{
+		keys:   NewMemoryAPIKeyStore(),
+		path:   path,
+		logger: logger.Named("authn.apikey").With(zap.String("file", path)),
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	w, err := fswatch.New([]string{path}, s.logger, s.reloadIfChanged)
+	if err != nil {
+		return nil, err
+	}
+	s.watcher = w
+
+	return s, nil
+}
+
+func (s *FileAPIKeyStore) Lookup(ctx context.Context, id string) (APIKeyRecord, bool, error) {
+	return s.keys.Lookup(ctx, id)
+}
+
+// Reload vuelve a leer el archivo de claves.
+func (s *FileAPIKeyStore) Reload() error {
+	return s.reload(true)
+}
+
+func (s *FileAPIKeyStore) reloadIfChanged() {
+	if err := s.reload(false); err != nil {
+		s.logger.Error("error al recargar las api keys, se mantienen las anteriores", zap.Error(err))
+	}
+}
+
+// reload lee el archivo y reemplaza las claves. Sin force, no hace nada si el
+// contenido es el mismo que el de la última carga.
+func (s *FileAPIKeyStore) reload(force bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	raw, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("error al leer las api keys: %w", err)
+	}
+	sum := sha256.Sum256(raw)
+	if !force && sum == s.sum {
+		return nil
+	}
+
+	var file apiKeyFile
+	switch strings.ToLower(filepath.Ext(s.path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, &file)
+	default:
+		err = json.Unmarshal(raw, &file)
+	}
+	if err != nil {
+		return fmt.Errorf("error al interpretar las api keys: %w", err)
+	}
+
+	for _, record := range file.Keys {
+		if record.ID == "" || record.Hash == "" {
+			return fmt.Errorf("api key sin id o hash en %s", s.path)
+		}
+	}
+
+	s.keys.Replace(file.Keys)
+	s.sum = sum
+	s.logger.Info("api keys cargadas", zap.Int("keys", len(file.Keys)))
+	return nil
+}
+
+// Close deja de observar el archivo.
+func (s *FileAPIKeyStore) Close() error {
+	return s.watcher.Close()
+}
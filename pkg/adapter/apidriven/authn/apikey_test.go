@@ -0,0 +1,267 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/norlis/httpgate/pkg/adapter/apidriven/middleware"
+	"github.com/norlis/httpgate/pkg/domain"
+)
+
+func newKey(t *testing.T, id string) (string, APIKeyRecord) {
+	t.Helper()
+	key, record, err := NewAPIKey(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Owner = id + "-owner"
+	record.Roles = []string{"deployer"}
+	return key, record
+}
+
+func requestWithAPIKey(target, key string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	if key != "" {
+		r.Header.Set("X-API-Key", key)
+	}
+	return r
+}
+
+func TestAPIKey_Extract(t *testing.T) {
+	validKey, valid := newKey(t, "ci")
+	expiredKey, expired := newKey(t, "old")
+	expired.ExpiresAt = time.Now().Add(-time.Hour)
+	revokedKey, revoked := newKey(t, "leaked")
+	revoked.Revoked = true
+
+	store := NewMemoryAPIKeyStore(valid, expired, revoked)
+	extract, err := APIKey(APIKeyConfig{QueryParam: "api_key"}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		request *http.Request
+		wantErr error
+	}{
+		{name: "header", request: requestWithAPIKey("/api/test", validKey)},
+		{name: "query param", request: requestWithAPIKey("/api/test?api_key="+validKey, "")},
+		{name: "missing", request: requestWithAPIKey("/api/test", ""), wantErr: middleware.ErrMissingCredentials},
+		{name: "wrong secret", request: requestWithAPIKey("/api/test", "ci.wrong"), wantErr: middleware.ErrInvalidCredentials},
+		{name: "unknown id", request: requestWithAPIKey("/api/test", "nobody.secret"), wantErr: middleware.ErrInvalidCredentials},
+		{name: "without id", request: requestWithAPIKey("/api/test", "secret"), wantErr: middleware.ErrInvalidCredentials},
+		{name: "expired", request: requestWithAPIKey("/api/test", expiredKey), wantErr: middleware.ErrInvalidCredentials},
+		{name: "revoked", request: requestWithAPIKey("/api/test", revokedKey), wantErr: middleware.ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := extract(tt.request)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("extract() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extract() error = %v", err)
+			}
+			if payload["sub"] != "ci-owner" || payload["keyId"] != "ci" {
+				t.Errorf("payload = %v", payload)
+			}
+			if roles := payload["roles"].([]string); len(roles) != 1 || roles[0] != "deployer" {
+				t.Errorf("roles = %v, want [deployer]", roles)
+			}
+		})
+	}
+
+	store.Revoke("ci")
+	if _, err := extract(requestWithAPIKey("/api/test", validKey)); !errors.Is(err, middleware.ErrInvalidCredentials) {
+		t.Errorf("extract() after Revoke error = %v, want invalid credentials", err)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Lookup(context.Context, string) (APIKeyRecord, bool, error) {
+	return APIKeyRecord{}, false, errors.New("connection refused")
+}
+
+func TestAPIKey_StoreOutageIsNotUnauthorized(t *testing.T) {
+	key, _ := newKey(t, "ci")
+	extract, err := APIKey(APIKeyConfig{}, failingStore{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := extract(requestWithAPIKey("/api/test", key)); !errors.Is(err, middleware.ErrAuthnUnavailable) {
+		t.Errorf("extract() error = %v, want ErrAuthnUnavailable", err)
+	}
+
+	w := httptest.NewRecorder()
+	middleware.AuthorizationMiddleware(&captureInput{}, extract)(http.NotFoundHandler()).ServeHTTP(w, requestWithAPIKey("/api/test", key))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", w.Code)
+	}
+	if got := w.Header().Get("WWW-Authenticate"); got != "" {
+		t.Errorf("WWW-Authenticate = %q, want none", got)
+	}
+}
+
+type captureInput struct{ input domain.PolicyInput }
+
+func (c *captureInput) IsAllowed(_ context.Context, input domain.PolicyInput) (bool, error) {
+	c.input = input
+	return true, nil
+}
+
+func TestAPIKey_StripsQueryParam(t *testing.T) {
+	key, record := newKey(t, "ci")
+	extract, err := APIKey(APIKeyConfig{QueryParam: "api_key"}, NewMemoryAPIKeyStore(record))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enforcer := &captureInput{}
+	var seen string
+	handler := middleware.AuthorizationMiddleware(enforcer, extract)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.URL.String()
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), requestWithAPIKey("/api/test?page=2&api_key="+key, ""))
+
+	if want := "GET:/api/test?page=2"; enforcer.input.Action != want {
+		t.Errorf("Action = %q, want %q", enforcer.input.Action, want)
+	}
+	if _, ok := enforcer.input.Request.Query["api_key"]; ok {
+		t.Errorf("Request.Query = %v, want without api_key", enforcer.input.Request.Query)
+	}
+	if strings.Contains(seen, key) {
+		t.Errorf("handler URL = %q, contains the api key", seen)
+	}
+}
+
+func TestFileAPIKeyStore_Reload(t *testing.T) {
+	firstKey, first := newKey(t, "first")
+	secondKey, second := newKey(t, "second")
+
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	write := func(records ...APIKeyRecord) {
+		t.Helper()
+		content := "keys:\n"
+		for _, r := range records {
+			content += fmt.Sprintf("  - id: %s\n    owner: %s\n    roles: [deployer]\n    salt: %s\n    hash: %s\n", r.ID, r.Owner, r.Salt, r.Hash)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(first)
+	store, err := NewFileAPIKeyStore(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	extract, err := APIKey(APIKeyConfig{}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := extract(requestWithAPIKey("/", firstKey)); err != nil {
+		t.Fatalf("extract() error = %v", err)
+	}
+
+	write(second)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, errFirst := extract(requestWithAPIKey("/", firstKey))
+		_, errSecond := extract(requestWithAPIKey("/", secondKey))
+		if errFirst != nil && errSecond == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("keys not reloaded: first = %v, second = %v", errFirst, errSecond)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// Un archivo inválido no debe descartar las claves vigentes.
+	if err := os.WriteFile(path, []byte("keys: [unclosed"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err == nil {
+		t.Error("Reload() error = nil, want error")
+	}
+	if _, err := extract(requestWithAPIKey("/", secondKey)); err != nil {
+		t.Errorf("extract() after invalid reload error = %v", err)
+	}
+}
+
+func TestFileAPIKeyStore_ReloadsMountedSecret(t *testing.T) {
+	firstKey, first := newKey(t, "first")
+	secondKey, second := newKey(t, "second")
+
+	// Kubernetes publica el Secret como keys.yaml -> ..data/keys.yaml y lo
+	// actualiza cambiando el destino de ..data, sin tocar keys.yaml.
+	dir := t.TempDir()
+	mount := func(version string, record APIKeyRecord) {
+		t.Helper()
+		content := fmt.Sprintf("keys:\n  - id: %s\n    owner: %s\n    salt: %s\n    hash: %s\n", record.ID, record.Owner, record.Salt, record.Hash)
+		if err := os.Mkdir(filepath.Join(dir, version), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, version, "keys.yaml"), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(version, filepath.Join(dir, "..data_tmp")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mount("..v1", first)
+	path := filepath.Join(dir, "keys.yaml")
+	if err := os.Symlink(filepath.Join("..data", "keys.yaml"), path); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewFileAPIKeyStore(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	extract, err := APIKey(APIKeyConfig{}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := extract(requestWithAPIKey("/", firstKey)); err != nil {
+		t.Fatalf("extract() error = %v", err)
+	}
+
+	mount("..v2", second)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, errFirst := extract(requestWithAPIKey("/", firstKey))
+		_, errSecond := extract(requestWithAPIKey("/", secondKey))
+		if errFirst != nil && errSecond == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("keys not reloaded: first = %v, second = %v", errFirst, errSecond)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
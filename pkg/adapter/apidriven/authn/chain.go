@@ -0,0 +1,132 @@
+package authn
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/norlis/httpgate/pkg/adapter/apidriven/middleware"
+)
+
+// AnonymousScheme es el esquema que se informa cuando ningún extractor
+// encontró credenciales y se permite el acceso anónimo.
+const AnonymousScheme = "anonymous"
+
+// Scheme es un extractor con el nombre con el que se informa en el payload.
+type Scheme struct {
+	Name    string
+	Extract middleware.PayloadExtractor
+}
+
+type ChainConfig struct {
+	// Merge evalúa todos los esquemas y combina los payloads que se obtengan en
+	// lugar de quedarse con el primero.
+	Merge bool `yaml:"merge"`
+	// Anonymous permite las peticiones sin credenciales con el rol AnonymousRole.
+	Anonymous bool `yaml:"anonymous"`
+	// AnonymousRole es el rol del payload anónimo, por defecto "anonymous"
+	// (el mismo que asume authz.rego cuando no hay roles).
+	AnonymousRole string `yaml:"anonymousRole"`
+}
+
+// Chain combina varios extractores. Los esquemas se prueban en orden y un
+// esquema sin credenciales (ErrMissingCredentials) cede el turno al siguiente;
+// cualquier otro error corta la cadena, para que unas credenciales inválidas
+// no terminen tratándose como anónimas.
+//
+// El payload incluye el esquema que autenticó la petición:
+//
+//	{"roles": ["admin"], "sub": "user-1", "authScheme": "jwt", "authSchemes": ["jwt"]}
+//
+// Con Merge, roles y scopes se unen, el resto de campos los aporta el primer
+// esquema que los tenga y authSchemes lista todos los que autenticaron.
+func Chain(cfg ChainConfig, schemes ...Scheme) (middleware.PayloadExtractor, error) {
+	if len(schemes) == 0 {
+		return nil, fmt.Errorf("se requiere al menos un esquema de autenticación")
+	}
+	for _, s := range schemes {
+		if s.Name == "" || s.Extract == nil {
+			return nil, fmt.Errorf("esquema de autenticación sin nombre o extractor")
+		}
+	}
+	if cfg.AnonymousRole == "" {
+		cfg.AnonymousRole = "anonymous"
+	}
+
+	return func(r *http.Request) (map[string]any, error) {
+		var (
+			merged  map[string]any
+			names   []string
+			missing error
+		)
+
+		for _, s := range schemes {
+			payload, err := s.Extract(r)
+			if err != nil {
+				if errors.Is(err, middleware.ErrMissingCredentials) {
+					if missing == nil {
+						missing = err
+					}
+					continue
+				}
+				return nil, err
+			}
+
+			names = append(names, s.Name)
+			merged = mergePayload(merged, payload)
+			if !cfg.Merge {
+				break
+			}
+		}
+
+		if merged == nil {
+			if !cfg.Anonymous {
+				return nil, missing
+			}
+			return map[string]any{
+				"roles":       []string{cfg.AnonymousRole},
+				"scopes":      []string{},
+				"authScheme":  AnonymousScheme,
+				"authSchemes": []string{AnonymousScheme},
+			}, nil
+		}
+
+		merged["authScheme"] = names[0]
+		merged["authSchemes"] = names
+		return merged, nil
+	}, nil
+}
+
+// mergePayload agrega payload sobre dst: une las listas roles y scopes y
+// conserva los valores que ya tenía dst en el resto de campos.
+func mergePayload(dst, payload map[string]any) map[string]any {
+	if dst == nil {
+		dst = make(map[string]any, len(payload)+2)
+	}
+	for key, value := range payload {
+		switch key {
+		case "roles", "scopes":
+			list, _ := dst[key].([]string)
+			for _, item := range stringListOf(value) {
+				if !slices.Contains(list, item) {
+					list = append(list, item)
+				}
+			}
+			dst[key] = nonNil(list)
+		default:
+			if _, ok := dst[key]; !ok {
+				dst[key] = value
+			}
+		}
+	}
+	return dst
+}
+
+// stringListOf acepta tanto []string como []any (p.ej. payloads decodificados de JSON).
+func stringListOf(v any) []string {
+	if list, ok := v.([]string); ok {
+		return list
+	}
+	return stringList(v)
+}
@@ -0,0 +1,124 @@
+package authn
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/norlis/httpgate/pkg/adapter/apidriven/middleware"
+)
+
+// headerScheme autentica si la petición trae la cabecera indicada.
+func headerScheme(name, header string, payload map[string]any) Scheme {
+	return Scheme{Name: name, Extract: func(r *http.Request) (map[string]any, error) {
+		switch r.Header.Get(header) {
+		case "":
+			return nil, middleware.MissingCredentials(name, "", "missing "+header)
+		case "bad":
+			return nil, middleware.InvalidCredentials(name, "", "invalid "+header, nil)
+		}
+		copied := make(map[string]any, len(payload))
+		for k, v := range payload {
+			copied[k] = v
+		}
+		return copied, nil
+	}}
+}
+
+func TestChain(t *testing.T) {
+	jwt := headerScheme("jwt", "Authorization", map[string]any{"roles": []string{"admin"}, "sub": "user-1"})
+	apiKey := headerScheme("apikey", "X-API-Key", map[string]any{"roles": []string{"deployer", "admin"}, "sub": "ci"})
+
+	tests := []struct {
+		name        string
+		cfg         ChainConfig
+		headers     map[string]string
+		wantErr     error
+		wantScheme  string
+		wantSchemes []string
+		wantRoles   []string
+		wantSub     string
+	}{
+		{
+			name:       "first scheme",
+			headers:    map[string]string{"Authorization": "t", "X-API-Key": "k"},
+			wantScheme: "jwt", wantSchemes: []string{"jwt"}, wantRoles: []string{"admin"}, wantSub: "user-1",
+		},
+		{
+			name:       "falls back to next scheme",
+			headers:    map[string]string{"X-API-Key": "k"},
+			wantScheme: "apikey", wantSchemes: []string{"apikey"}, wantRoles: []string{"deployer", "admin"}, wantSub: "ci",
+		},
+		{
+			name:    "invalid credentials stop the chain",
+			headers: map[string]string{"Authorization": "bad", "X-API-Key": "k"},
+			wantErr: middleware.ErrInvalidCredentials,
+		},
+		{
+			name:    "no credentials",
+			wantErr: middleware.ErrMissingCredentials,
+		},
+		{
+			name:       "anonymous",
+			cfg:        ChainConfig{Anonymous: true},
+			wantScheme: AnonymousScheme, wantSchemes: []string{AnonymousScheme}, wantRoles: []string{"anonymous"},
+		},
+		{
+			name:    "anonymous does not hide invalid credentials",
+			cfg:     ChainConfig{Anonymous: true},
+			headers: map[string]string{"X-API-Key": "bad"},
+			wantErr: middleware.ErrInvalidCredentials,
+		},
+		{
+			name:       "custom anonymous role",
+			cfg:        ChainConfig{Anonymous: true, AnonymousRole: "guest"},
+			wantScheme: AnonymousScheme, wantSchemes: []string{AnonymousScheme}, wantRoles: []string{"guest"},
+		},
+		{
+			name:       "merge",
+			cfg:        ChainConfig{Merge: true},
+			headers:    map[string]string{"Authorization": "t", "X-API-Key": "k"},
+			wantScheme: "jwt", wantSchemes: []string{"jwt", "apikey"}, wantRoles: []string{"admin", "deployer"}, wantSub: "user-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extract, err := Chain(tt.cfg, jwt, apiKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			payload, err := extract(r)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("extract() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extract() error = %v", err)
+			}
+
+			if payload["authScheme"] != tt.wantScheme {
+				t.Errorf("authScheme = %v, want %v", payload["authScheme"], tt.wantScheme)
+			}
+			if got := payload["authSchemes"].([]string); !slices.Equal(got, tt.wantSchemes) {
+				t.Errorf("authSchemes = %v, want %v", got, tt.wantSchemes)
+			}
+			if got := payload["roles"].([]string); !slices.Equal(got, tt.wantRoles) {
+				t.Errorf("roles = %v, want %v", got, tt.wantRoles)
+			}
+			if tt.wantSub != "" && payload["sub"] != tt.wantSub {
+				t.Errorf("sub = %v, want %v", payload["sub"], tt.wantSub)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package authn
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// jwksFetchTimeout limita cada lectura del JWKS; no depende de la petición que
+// la disparó.
+const jwksFetchTimeout = 10 * time.Second
+
+// minRSAKeyBits es el tamaño mínimo de las claves RSA que se aceptan del JWKS.
+const minRSAKeyBits = 2048
+
+// jwk es una clave JSON Web Key (RFC 7517). Solo se leen los campos necesarios
+// para las claves públicas RSA, EC P-256, Ed25519 y las claves simétricas.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// verificationKey es una clave lista para verificar firmas.
+type verificationKey struct {
+	kid string
+	alg string // vacío si la clave no lo restringe
+	key crypto.PublicKey
+}
+
+func (k jwk) parse() (verificationKey, error) {
+	vk := verificationKey{kid: k.Kid, alg: k.Alg}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return vk, err
+		}
+		if n.BitLen() < minRSAKeyBits {
+			return vk, fmt.Errorf("clave RSA de %d bits, se requieren al menos %d", n.BitLen(), minRSAKeyBits)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return vk, err
+		}
+		// El exponente debe caber en un int de 32 bits, como exige crypto/rsa.
+		if e.BitLen() > 31 || e.Int64() < 2 {
+			return vk, fmt.Errorf("exponente RSA inválido")
+		}
+		vk.key = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		if k.Crv != "P-256" {
+			return vk, fmt.Errorf("curva no soportada: %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return vk, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return vk, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !pub.Curve.IsOnCurve(x, y) {
+			return vk, fmt.Errorf("punto fuera de la curva")
+		}
+		vk.key = pub
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return vk, fmt.Errorf("curva no soportada: %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return vk, fmt.Errorf("clave Ed25519 inválida")
+		}
+		vk.key = ed25519.PublicKey(x)
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return vk, fmt.Errorf("clave simétrica inválida")
+		}
+		vk.key = secret
+	default:
+		return vk, fmt.Errorf("tipo de clave no soportado: %s", k.Kty)
+	}
+
+	return vk, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("entero base64url inválido")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// keySet mantiene en memoria las claves de un JWKS y las vuelve a leer cuando
+// vence refreshInterval o cuando llega un token firmado con un kid desconocido
+// (rotación de claves). Cualquier lectura, haya salido bien o no, espera
+// minRefreshInterval desde el intento anterior, para que ni un token falso ni
+// una caída del proveedor provoquen una descarga por petición.
+//
+// Las lecturas se hacen fuera del mutex, de a una por vez y con un contexto
+// propio: mientras tanto se siguen sirviendo las claves en caché, y solo
+// esperan las peticiones que no tienen otra opción (primera carga o kid
+// desconocido).
+type keySet struct {
+	file               string
+	url                string
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+	httpClient         *http.Client
+	now                func() time.Time
+
+	mu          sync.Mutex
+	keys        []verificationKey
+	loadedAt    time.Time
+	attemptedAt time.Time
+	lastErr     error
+	inflight    chan struct{} // no nil mientras hay una lectura en curso
+}
+
+// lookup devuelve las claves candidatas para el kid indicado.
+func (s *keySet) lookup(ctx context.Context, kid string) ([]verificationKey, error) {
+	s.mu.Lock()
+	now := s.now()
+
+	if s.keys == nil {
+		done := s.inflight
+		if done == nil {
+			if now.Sub(s.attemptedAt) <= s.minRefreshInterval && s.lastErr != nil {
+				err := s.lastErr
+				s.mu.Unlock()
+				return nil, err
+			}
+			done = s.startRefresh(now)
+		}
+		s.mu.Unlock()
+		return s.await(ctx, done, kid)
+	}
+
+	stale := now.Sub(s.loadedAt) > s.refreshInterval
+	canRefresh := now.Sub(s.attemptedAt) > s.minRefreshInterval
+	if stale && canRefresh && s.inflight == nil {
+		s.startRefresh(now)
+	}
+
+	if found := s.match(kid); len(found) > 0 {
+		s.mu.Unlock()
+		return found, nil
+	}
+
+	// Kid desconocido: puede ser una rotación, así que vale la pena esperar
+	// una lectura nueva si el límite lo permite.
+	done := s.inflight
+	if done == nil && canRefresh {
+		done = s.startRefresh(now)
+	}
+	s.mu.Unlock()
+
+	if done == nil {
+		return nil, nil
+	}
+	return s.await(ctx, done, kid)
+}
+
+// startRefresh lanza una lectura en segundo plano. Debe llamarse con s.mu
+// tomado y sin otra lectura en curso.
+func (s *keySet) startRefresh(now time.Time) chan struct{} {
+	done := make(chan struct{})
+	s.inflight, s.attemptedAt = done, now
+	go s.refresh(done)
+	return done
+}
+
+// await espera a que termine la lectura en curso o a que se cancele la
+// petición; la lectura sigue aunque la petición se cancele.
+func (s *keySet) await(ctx context.Context, done <-chan struct{}, kid string) ([]verificationKey, error) {
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys == nil && s.lastErr != nil {
+		return nil, s.lastErr
+	}
+	return s.match(kid), nil
+}
+
+// wait bloquea hasta que termina la lectura en curso, si la hay.
+func (s *keySet) wait() {
+	s.mu.Lock()
+	done := s.inflight
+	s.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+func (s *keySet) match(kid string) []verificationKey {
+	var found []verificationKey
+	for _, k := range s.keys {
+		if kid == "" || k.kid == kid {
+			found = append(found, k)
+		}
+	}
+	return found
+}
+
+// refresh vuelve a leer el JWKS y cierra done al terminar. Si falla se
+// conservan las claves anteriores.
+func (s *keySet) refresh(done chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+	defer cancel()
+
+	keys, err := s.load(ctx)
+
+	s.mu.Lock()
+	if err == nil {
+		s.keys, s.loadedAt = keys, s.now()
+	}
+	s.lastErr, s.inflight = err, nil
+	s.mu.Unlock()
+	close(done)
+}
+
+func (s *keySet) load(ctx context.Context) ([]verificationKey, error) {
+	raw, err := s.fetch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo leer el JWKS: %w", err)
+	}
+
+	var set jwks
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("JWKS inválido: %w", err)
+	}
+
+	keys := make([]verificationKey, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		vk, err := k.parse()
+		if err != nil {
+			// Una clave desconocida no invalida el resto del conjunto.
+			continue
+		}
+		keys = append(keys, vk)
+	}
+
+	return keys, nil
+}
+
+func (s *keySet) fetch(ctx context.Context) ([]byte, error) {
+	if s.file != "" {
+		return os.ReadFile(s.file)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("estado %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
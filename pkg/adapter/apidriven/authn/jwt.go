@@ -0,0 +1,330 @@
+// Package authn contiene extractores de identidad (PayloadExtractor) para
+// AuthorizationMiddleware: validan las credenciales de la petición y
+// construyen el payload que recibe la política.
+package authn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/norlis/httpgate/pkg/adapter/apidriven/middleware"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+	AlgHS256 = "HS256"
+
+	defaultJWKSRefresh = 10 * time.Minute
+	defaultClockSkew   = 30 * time.Second
+)
+
+type JWTConfig struct {
+	JWKSFile        string        `yaml:"jwksFile"`        // JWKS local, se vuelve a leer cada RefreshInterval
+	JWKSURL         string        `yaml:"jwksUrl"`         // JWKS remoto, p.ej. https://idp/.well-known/jwks.json
+	RefreshInterval time.Duration `yaml:"refreshInterval"` // por defecto 10m
+	Algorithms      []string      `yaml:"algorithms"`      // por defecto RS256, ES256, EdDSA y HS256
+	Issuer          string        `yaml:"issuer"`          // si se define, debe coincidir con iss
+	Audience        []string      `yaml:"audience"`        // si se define, aud debe contener alguno
+	ClockSkew       time.Duration `yaml:"clockSkew"`       // tolerancia para exp y nbf, por defecto 30s
+	Realm           string        `yaml:"realm"`           // se informa en WWW-Authenticate
+	Claims          ClaimsMapping `yaml:"claims"`
+}
+
+// ClaimsMapping indica de qué claims se obtiene cada campo del payload. Admite
+// rutas con puntos para claims anidados, p.ej. "realm_access.roles".
+type ClaimsMapping struct {
+	Roles   string `yaml:"roles"`   // por defecto "roles"
+	Scopes  string `yaml:"scopes"`  // por defecto "scope", admite string separado por espacios o lista
+	Subject string `yaml:"subject"` // por defecto "sub"
+	Tenant  string `yaml:"tenant"`  // por defecto "tenant"
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtVerifier struct {
+	cfg  JWTConfig
+	keys *keySet
+	now  func() time.Time
+}
+
+// JWT devuelve un extractor que valida el token "Authorization: Bearer" y
+// construye el payload con roles, scopes, sub y tenant:
+//
+//	{"roles": ["admin"], "scopes": ["read"], "sub": "user-1", "tenant": "acme"}
+func JWT(cfg JWTConfig) (middleware.PayloadExtractor, error) {
+	v, err := newJWTVerifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return v.extract, nil
+}
+
+func newJWTVerifier(cfg JWTConfig) (*jwtVerifier, error) {
+	if (cfg.JWKSFile == "") == (cfg.JWKSURL == "") {
+		return nil, fmt.Errorf("se requiere exactamente uno de jwksFile o jwksUrl")
+	}
+
+	if len(cfg.Algorithms) == 0 {
+		cfg.Algorithms = []string{AlgRS256, AlgES256, AlgEdDSA, AlgHS256}
+	}
+	for _, alg := range cfg.Algorithms {
+		if !slices.Contains([]string{AlgRS256, AlgES256, AlgEdDSA, AlgHS256}, alg) {
+			return nil, fmt.Errorf("algoritmo no soportado: %s", alg)
+		}
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = defaultJWKSRefresh
+	}
+	if cfg.ClockSkew <= 0 {
+		cfg.ClockSkew = defaultClockSkew
+	}
+	cfg.Claims = cfg.Claims.withDefaults()
+
+	return &jwtVerifier{
+		cfg: cfg,
+		keys: &keySet{
+			file:               cfg.JWKSFile,
+			url:                cfg.JWKSURL,
+			refreshInterval:    cfg.RefreshInterval,
+			minRefreshInterval: 30 * time.Second,
+			httpClient:         &http.Client{Timeout: 10 * time.Second},
+			now:                time.Now,
+		},
+		now: time.Now,
+	}, nil
+}
+
+func (v *jwtVerifier) extract(r *http.Request) (map[string]any, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, middleware.MissingCredentials("Bearer", v.cfg.Realm, "missing bearer token")
+	}
+
+	claims, err := v.verify(r, token)
+	if errors.Is(err, middleware.ErrAuthnUnavailable) {
+		return nil, err
+	}
+	if err != nil {
+		authErr := middleware.InvalidCredentials("Bearer", v.cfg.Realm, err.Error(), nil)
+		authErr.Code = "invalid_token"
+		return nil, authErr
+	}
+
+	return v.cfg.Claims.payload(claims), nil
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// verify comprueba la firma y los claims registrados del token y devuelve sus claims.
+func (v *jwtVerifier) verify(r *http.Request, token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errors.New("malformed token header")
+	}
+	if !slices.Contains(v.cfg.Algorithms, header.Alg) {
+		return nil, fmt.Errorf("algorithm %q not allowed", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+
+	// Si el JWKS no se pudo leer no se sabe si el token es válido: es un fallo
+	// del servidor, no del token. Un kid desconocido sí termina en 401.
+	keys, err := v.keys.lookup(r.Context(), header.Kid)
+	if err != nil {
+		return nil, middleware.AuthnUnavailable("signing keys unavailable", err)
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range keys {
+		if key.alg != "" && key.alg != header.Alg {
+			continue
+		}
+		if verifySignature(header.Alg, key, signed, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.New("invalid signature")
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errors.New("malformed token claims")
+	}
+
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func decodeSegment(segment string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// verifySignature comprueba la firma exigiendo que el tipo de clave corresponda
+// al algoritmo, para evitar ataques de confusión de algoritmo.
+func verifySignature(alg string, key verificationKey, signed, signature []byte) bool {
+	digest := sha256.Sum256(signed)
+
+	switch alg {
+	case AlgRS256:
+		pub, ok := key.key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil
+	case AlgES256:
+		pub, ok := key.key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return false
+		}
+		rInt := new(big.Int).SetBytes(signature[:32])
+		sInt := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(pub, digest[:], rInt, sInt)
+	case AlgEdDSA:
+		pub, ok := key.key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(pub, signed, signature)
+	case AlgHS256:
+		secret, ok := key.key.([]byte)
+		if !ok {
+			return false
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		return subtle.ConstantTimeCompare(mac.Sum(nil), signature) == 1
+	}
+
+	return false
+}
+
+func (v *jwtVerifier) validateClaims(claims map[string]any) error {
+	now := v.now()
+	skew := v.cfg.ClockSkew
+
+	if exp, ok := numericDate(claims["exp"]); ok && now.After(exp.Add(skew)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Before(nbf.Add(-skew)) {
+		return errors.New("token not yet valid")
+	}
+
+	if v.cfg.Issuer != "" && claims["iss"] != v.cfg.Issuer {
+		return errors.New("invalid issuer")
+	}
+
+	if len(v.cfg.Audience) > 0 {
+		audiences := stringList(claims["aud"])
+		if !slices.ContainsFunc(audiences, func(aud string) bool { return slices.Contains(v.cfg.Audience, aud) }) {
+			return errors.New("invalid audience")
+		}
+	}
+
+	return nil
+}
+
+func numericDate(v any) (time.Time, bool) {
+	f, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+func (m ClaimsMapping) withDefaults() ClaimsMapping {
+	if m.Roles == "" {
+		m.Roles = "roles"
+	}
+	if m.Scopes == "" {
+		m.Scopes = "scope"
+	}
+	if m.Subject == "" {
+		m.Subject = "sub"
+	}
+	if m.Tenant == "" {
+		m.Tenant = "tenant"
+	}
+	return m
+}
+
+// payload construye el payload de la política a partir de los claims.
+func (m ClaimsMapping) payload(claims map[string]any) map[string]any {
+	payload := map[string]any{
+		"roles":  stringList(claimAt(claims, m.Roles)),
+		"scopes": stringList(claimAt(claims, m.Scopes)),
+	}
+	if sub, ok := claimAt(claims, m.Subject).(string); ok {
+		payload["sub"] = sub
+	}
+	if tenant, ok := claimAt(claims, m.Tenant).(string); ok {
+		payload["tenant"] = tenant
+	}
+	return payload
+}
+
+// claimAt resuelve una ruta con puntos dentro de los claims.
+func claimAt(claims map[string]any, path string) any {
+	var current any = claims
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = obj[key]
+	}
+	return current
+}
+
+// stringList normaliza un claim que puede ser string (separado por espacios) o lista.
+func stringList(v any) []string {
+	list := []string{}
+	switch value := v.(type) {
+	case string:
+		list = append(list, strings.Fields(value)...)
+	case []any:
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+	}
+	return list
+}
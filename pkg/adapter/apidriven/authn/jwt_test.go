@@ -0,0 +1,376 @@
+package authn
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/norlis/httpgate/pkg/adapter/apidriven/middleware"
+	"github.com/norlis/httpgate/pkg/domain"
+)
+
+var b64 = base64.RawURLEncoding
+
+type testKeys struct {
+	rsa     *rsa.PrivateKey
+	ec      *ecdsa.PrivateKey
+	ed      ed25519.PrivateKey
+	hmacKey []byte
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKeys{rsa: rsaKey, ec: ecKey, ed: edKey, hmacKey: []byte("0123456789abcdef0123456789abcdef")}
+}
+
+func (k testKeys) jwks() []byte {
+	pad := func(b []byte) []byte {
+		out := make([]byte, 32)
+		copy(out[32-len(b):], b)
+		return out
+	}
+	set := jwks{Keys: []jwk{
+		{Kty: "RSA", Kid: "rsa", N: b64.EncodeToString(k.rsa.N.Bytes()), E: b64.EncodeToString(big.NewInt(int64(k.rsa.E)).Bytes())},
+		{Kty: "EC", Kid: "ec", Crv: "P-256", X: b64.EncodeToString(pad(k.ec.X.Bytes())), Y: b64.EncodeToString(pad(k.ec.Y.Bytes()))},
+		{Kty: "OKP", Kid: "ed", Crv: "Ed25519", X: b64.EncodeToString(k.ed.Public().(ed25519.PublicKey))},
+		{Kty: "oct", Kid: "hs", K: b64.EncodeToString(k.hmacKey)},
+	}}
+	raw, _ := json.Marshal(set)
+	return raw
+}
+
+func (k testKeys) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	var err error
+	switch alg {
+	case AlgRS256:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:])
+	case AlgES256:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k.ec, digest[:])
+		if err == nil {
+			sig = make([]byte, 64)
+			r.FillBytes(sig[:32])
+			s.FillBytes(sig[32:])
+		}
+	case AlgEdDSA:
+		sig = ed25519.Sign(k.ed, []byte(signed))
+	case AlgHS256:
+		mac := hmac.New(sha256.New, k.hmacKey)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+func writeJWKS(t *testing.T, raw []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func requestWithToken(token string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func TestJWT_Algorithms(t *testing.T) {
+	keys := newTestKeys(t)
+	extract, err := JWT(JWTConfig{JWKSFile: writeJWKS(t, keys.jwks())})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := map[string]any{
+		"sub":    "user-1",
+		"roles":  []string{"admin"},
+		"scope":  "read write",
+		"tenant": "acme",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	}
+
+	for alg, kid := range map[string]string{AlgRS256: "rsa", AlgES256: "ec", AlgEdDSA: "ed", AlgHS256: "hs"} {
+		t.Run(alg, func(t *testing.T) {
+			payload, err := extract(requestWithToken(keys.sign(t, alg, kid, claims)))
+			if err != nil {
+				t.Fatalf("extract() error = %v", err)
+			}
+			if payload["sub"] != "user-1" || payload["tenant"] != "acme" {
+				t.Errorf("payload = %v", payload)
+			}
+			if roles := payload["roles"].([]string); len(roles) != 1 || roles[0] != "admin" {
+				t.Errorf("roles = %v, want [admin]", roles)
+			}
+			if scopes := payload["scopes"].([]string); len(scopes) != 2 {
+				t.Errorf("scopes = %v, want [read write]", scopes)
+			}
+		})
+	}
+}
+
+func TestJWT_RejectsInvalidTokens(t *testing.T) {
+	keys := newTestKeys(t)
+	other := newTestKeys(t)
+	extract, err := JWT(JWTConfig{
+		JWKSFile:   writeJWKS(t, keys.jwks()),
+		Algorithms: []string{AlgRS256, AlgES256},
+		Issuer:     "https://idp.example.com",
+		Audience:   []string{"httpgate"},
+		ClockSkew:  time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := func() map[string]any {
+		return map[string]any{
+			"iss": "https://idp.example.com",
+			"aud": []string{"other", "httpgate"},
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+	}
+	with := func(key string, value any) map[string]any {
+		c := valid()
+		c[key] = value
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "missing"},
+		{name: "garbage", token: "not-a-jwt"},
+		{name: "expired", token: keys.sign(t, AlgRS256, "rsa", with("exp", time.Now().Add(-time.Minute).Unix()))},
+		{name: "not yet valid", token: keys.sign(t, AlgRS256, "rsa", with("nbf", time.Now().Add(time.Minute).Unix()))},
+		{name: "wrong issuer", token: keys.sign(t, AlgRS256, "rsa", with("iss", "https://evil.example.com"))},
+		{name: "wrong audience", token: keys.sign(t, AlgRS256, "rsa", with("aud", "other"))},
+		{name: "untrusted key", token: other.sign(t, AlgRS256, "rsa", valid())},
+		{name: "algorithm not allowed", token: keys.sign(t, AlgHS256, "hs", valid())},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := middleware.ErrInvalidCredentials
+			if tt.token == "" {
+				want = middleware.ErrMissingCredentials
+			}
+			if _, err := extract(requestWithToken(tt.token)); !errors.Is(err, want) {
+				t.Errorf("extract() error = %v, want %v", err, want)
+			}
+		})
+	}
+
+	if _, err := extract(requestWithToken(keys.sign(t, AlgES256, "ec", valid()))); err != nil {
+		t.Errorf("extract() valid token error = %v", err)
+	}
+}
+
+func TestJWT_RotatesKeysFromURL(t *testing.T) {
+	first, second := newTestKeys(t), newTestKeys(t)
+	var current atomic.Pointer[[]byte]
+	raw := first.jwks()
+	current.Store(&raw)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(*current.Load())
+	}))
+	defer srv.Close()
+
+	v, err := newJWTVerifier(JWTConfig{JWKSURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	v.keys.now = func() time.Time { return now }
+
+	if _, err := v.extract(requestWithToken(first.sign(t, AlgEdDSA, "ed", map[string]any{}))); err != nil {
+		t.Fatalf("extract() error = %v", err)
+	}
+
+	// El proveedor rota la clave manteniendo el kid: hasta que se vuelva a
+	// leer el JWKS, la firma nueva no se reconoce.
+	raw = second.jwks()
+	current.Store(&raw)
+	token := second.sign(t, AlgEdDSA, "ed", map[string]any{})
+	if _, err := v.extract(requestWithToken(token)); err == nil {
+		t.Fatal("extract() error = nil before refresh, want error")
+	}
+
+	// Vencido el intervalo, la petición sigue viendo las claves en caché y
+	// dispara la lectura en segundo plano.
+	now = now.Add(defaultJWKSRefresh + time.Second)
+	_, _ = v.extract(requestWithToken(token))
+	v.keys.wait()
+	if _, err := v.extract(requestWithToken(token)); err != nil {
+		t.Errorf("extract() error = %v after refresh", err)
+	}
+}
+
+func TestJWT_ServesCachedKeysDuringOutage(t *testing.T) {
+	keys := newTestKeys(t)
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) > 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write(keys.jwks())
+	}))
+	defer srv.Close()
+
+	v, err := newJWTVerifier(JWTConfig{JWKSURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	v.keys.now = func() time.Time { return now }
+
+	token := keys.sign(t, AlgEdDSA, "ed", map[string]any{})
+	if _, err := v.extract(requestWithToken(token)); err != nil {
+		t.Fatalf("extract() error = %v", err)
+	}
+
+	// El proveedor cae: las peticiones siguen validando con las claves en
+	// caché y solo se reintenta una vez por minRefreshInterval.
+	now = now.Add(defaultJWKSRefresh + time.Second)
+	for range 5 {
+		if _, err := v.extract(requestWithToken(token)); err != nil {
+			t.Errorf("extract() error = %v during outage", err)
+		}
+		v.keys.wait()
+	}
+	if got := hits.Load(); got != 2 {
+		t.Errorf("JWKS hits = %d, want 2", got)
+	}
+
+	now = now.Add(v.keys.minRefreshInterval + time.Second)
+	_, _ = v.extract(requestWithToken(token))
+	v.keys.wait()
+	if got := hits.Load(); got != 3 {
+		t.Errorf("JWKS hits = %d after minRefreshInterval, want 3", got)
+	}
+}
+
+func TestJWK_RejectsWeakRSAKeys(t *testing.T) {
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strong := newTestKeys(t).rsa
+	b64 := base64.RawURLEncoding
+	n := b64.EncodeToString(strong.N.Bytes())
+
+	tests := []struct {
+		name    string
+		key     jwk
+		wantErr bool
+	}{
+		{name: "2048 bits", key: jwk{Kty: "RSA", N: n, E: "AQAB"}},
+		{name: "1024 bits", key: jwk{Kty: "RSA", N: b64.EncodeToString(weak.N.Bytes()), E: "AQAB"}, wantErr: true},
+		{name: "exponent 1", key: jwk{Kty: "RSA", N: n, E: b64.EncodeToString([]byte{1})}, wantErr: true},
+		{name: "exponent too large", key: jwk{Kty: "RSA", N: n, E: b64.EncodeToString([]byte{1, 0, 0, 0, 0, 0, 0, 0, 1})}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.key.parse(); (err != nil) != tt.wantErr {
+				t.Errorf("parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWT_UnavailableJWKS(t *testing.T) {
+	keys := newTestKeys(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	extract, err := JWT(JWTConfig{JWKSURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := middleware.AuthorizationMiddleware(allowAll{}, extract)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, requestWithToken(keys.sign(t, AlgEdDSA, "ed", map[string]any{})))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", w.Code)
+	}
+	if got := w.Header().Get("WWW-Authenticate"); got != "" {
+		t.Errorf("WWW-Authenticate = %q, want none", got)
+	}
+}
+
+type allowAll struct{}
+
+func (allowAll) IsAllowed(context.Context, domain.PolicyInput) (bool, error) { return true, nil }
+
+func TestJWT_MiddlewareRespondsUnauthorized(t *testing.T) {
+	keys := newTestKeys(t)
+	extract, err := JWT(JWTConfig{JWKSFile: writeJWKS(t, keys.jwks()), Realm: "httpgate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := middleware.AuthorizationMiddleware(allowAll{}, extract)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, requestWithToken("not-a-jwt"))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", w.Code)
+	}
+	challenge := w.Header().Get("WWW-Authenticate")
+	if !strings.HasPrefix(challenge, `Bearer realm="httpgate", error="invalid_token"`) {
+		t.Errorf("WWW-Authenticate = %q", challenge)
+	}
+}
@@ -0,0 +1,72 @@
+package authn
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/norlis/httpgate/pkg/adapter/apidriven/middleware"
+)
+
+type ClientCertConfig struct {
+	// TrustDomain, si se define, exige que el certificado tenga un SPIFFE ID
+	// de ese dominio, p.ej. "prod.example.com".
+	TrustDomain string `yaml:"trustDomain"`
+}
+
+// ClientCert devuelve un extractor que identifica al cliente por el certificado
+// verificado en el handshake mTLS y construye el payload:
+//
+//	{"roles": [], "scopes": [], "sub": "spiffe://prod.example.com/ns/billing/sa/api",
+//	 "cn": "billing-api", "ou": ["billing"], "uris": ["spiffe://..."],
+//	 "spiffeId": "spiffe://prod.example.com/ns/billing/sa/api"}
+//
+// sub es el SPIFFE ID si existe o, en su defecto, el CN. El servidor debe
+// verificar los certificados (ver NewServerTLSConfig): solo se consideran los
+// de r.TLS.VerifiedChains.
+func ClientCert(cfg ClientCertConfig) (middleware.PayloadExtractor, error) {
+	if strings.Contains(cfg.TrustDomain, "/") {
+		return nil, fmt.Errorf("trustDomain debe ser solo el dominio, sin spiffe:// ni ruta: %q", cfg.TrustDomain)
+	}
+
+	return func(r *http.Request) (map[string]any, error) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			return nil, middleware.MissingCredentials("", "", "verified client certificate required")
+		}
+		cert := r.TLS.VerifiedChains[0][0]
+
+		uris := []string{}
+		spiffeID := ""
+		for _, u := range cert.URIs {
+			uris = append(uris, u.String())
+			if spiffeID == "" && u.Scheme == "spiffe" {
+				spiffeID = u.String()
+			}
+		}
+
+		if cfg.TrustDomain != "" && !inTrustDomain(spiffeID, cfg.TrustDomain) {
+			return nil, middleware.InvalidCredentials("", "", "client certificate is not from the trusted domain", nil)
+		}
+
+		sub := spiffeID
+		if sub == "" {
+			sub = cert.Subject.CommonName
+		}
+
+		return map[string]any{
+			"roles":    []string{},
+			"scopes":   []string{},
+			"sub":      sub,
+			"cn":       cert.Subject.CommonName,
+			"ou":       nonNil(cert.Subject.OrganizationalUnit),
+			"uris":     uris,
+			"spiffeId": spiffeID,
+		}, nil
+	}, nil
+}
+
+func inTrustDomain(spiffeID, trustDomain string) bool {
+	u, err := url.Parse(spiffeID)
+	return err == nil && u.Scheme == "spiffe" && strings.EqualFold(u.Host, trustDomain)
+}
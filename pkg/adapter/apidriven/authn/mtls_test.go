@@ -0,0 +1,221 @@
+package authn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/norlis/httpgate/pkg/adapter/apidriven/middleware"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue emite un certificado hoja firmado por la CA y lo devuelve en PEM junto a su clave.
+func (ca testCA) issue(t *testing.T, tmpl *x509.Certificate) (certPEM, keyPEM []byte, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawKey, _ := x509.MarshalECPrivateKey(key)
+	cert, _ = x509.ParseCertificate(der)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: rawKey}),
+		cert
+}
+
+func clientTemplate(cn, spiffeID string) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: cn, OrganizationalUnit: []string{"billing"}},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if spiffeID != "" {
+		u, _ := url.Parse(spiffeID)
+		tmpl.URIs = []*url.URL{u}
+	}
+	return tmpl
+}
+
+func TestClientCert_Extract(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	_, _, spiffeCert := ca.issue(t, clientTemplate("billing-api", "spiffe://prod.example.com/ns/billing/sa/api"))
+	_, _, plainCert := ca.issue(t, clientTemplate("legacy", ""))
+
+	withCert := func(cert *x509.Certificate) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+		if cert != nil {
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert, ca.cert}}}
+		}
+		return r
+	}
+
+	extract, err := ClientCert(ClientCertConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := extract(withCert(spiffeCert))
+	if err != nil {
+		t.Fatalf("extract() error = %v", err)
+	}
+	if payload["sub"] != "spiffe://prod.example.com/ns/billing/sa/api" || payload["cn"] != "billing-api" {
+		t.Errorf("payload = %v", payload)
+	}
+	if ou := payload["ou"].([]string); len(ou) != 1 || ou[0] != "billing" {
+		t.Errorf("ou = %v, want [billing]", ou)
+	}
+
+	payload, err = extract(withCert(plainCert))
+	if err != nil {
+		t.Fatalf("extract() error = %v", err)
+	}
+	if payload["sub"] != "legacy" || payload["spiffeId"] != "" {
+		t.Errorf("payload = %v, want sub = CN", payload)
+	}
+
+	if _, err := extract(withCert(nil)); !errors.Is(err, middleware.ErrMissingCredentials) {
+		t.Errorf("extract() without certificate error = %v, want missing credentials", err)
+	}
+
+	restricted, err := ClientCert(ClientCertConfig{TrustDomain: "staging.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restricted(withCert(spiffeCert)); !errors.Is(err, middleware.ErrInvalidCredentials) {
+		t.Errorf("extract() from other trust domain error = %v, want invalid credentials", err)
+	}
+}
+
+func TestNewServerTLSConfig_ReloadsClientCAs(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content []byte) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	serverCA, oldClientCA, newClientCA := newTestCA(t, "server-ca"), newTestCA(t, "old-ca"), newTestCA(t, "new-ca")
+	serverCert, serverKey, _ := serverCA.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+
+	cfg := ServerTLSConfig{
+		CertFile:     write("server.pem", serverCert),
+		KeyFile:      write("server-key.pem", serverKey),
+		ClientCAFile: write("clients.pem", oldClientCA.pem),
+	}
+	reloader, err := newTLSReloader(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	extract, _ := ClientCert(ClientCertConfig{})
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, err := extract(r)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(payload["sub"].(string)))
+	}))
+	srv.TLS = reloader.config()
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCA.cert)
+	get := func(ca testCA) error {
+		certPEM, keyPEM, _ := ca.issue(t, clientTemplate("worker", "spiffe://prod.example.com/worker"))
+		clientCert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: []tls.Certificate{clientCert},
+		}}}
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return errors.New(resp.Status)
+		}
+		return nil
+	}
+
+	if err := get(oldClientCA); err != nil {
+		t.Fatalf("GET with trusted client certificate: %v", err)
+	}
+	if err := get(newClientCA); err == nil {
+		t.Fatal("GET with untrusted client certificate succeeded")
+	}
+
+	// Se rota la CA de clientes; la comprobación de cambios se fuerza con un
+	// mtime distinto en lugar de esperar el intervalo de recarga.
+	write("clients.pem", newClientCA.pem)
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(cfg.ClientCAFile, future, future)
+	reloader.mu.Lock()
+	reloader.checkedAt = time.Time{}
+	reloader.mu.Unlock()
+
+	if err := get(newClientCA); err != nil {
+		t.Errorf("GET after CA rotation: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package authn
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultTLSReloadInterval = time.Minute
+
+type ServerTLSConfig struct {
+	CertFile     string `yaml:"certFile"`
+	KeyFile      string `yaml:"keyFile"`
+	ClientCAFile string `yaml:"clientCaFile"` // PEM con las CAs que firman los certificados de cliente
+	// ClientAuthOptional acepta conexiones sin certificado de cliente (los que
+	// se presenten se siguen verificando); el extractor responde 401 en ese caso.
+	ClientAuthOptional bool          `yaml:"clientAuthOptional"`
+	ReloadInterval     time.Duration `yaml:"reloadInterval"` // cada cuánto se comprueba si cambiaron los archivos, por defecto 1m
+}
+
+// NewServerTLSConfig construye el tls.Config del servidor para mTLS. El
+// certificado del servidor y las CAs de cliente se vuelven a leer cuando
+// cambian los archivos (p.ej. rotación de cert-manager o SPIRE), sin reiniciar.
+// Si la recarga falla se mantienen los últimos válidos.
+func NewServerTLSConfig(cfg ServerTLSConfig, logger *zap.Logger) (*tls.Config, error) {
+	r, err := newTLSReloader(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	return r.config(), nil
+}
+
+func newTLSReloader(cfg ServerTLSConfig, logger *zap.Logger) (*tlsReloader, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" || cfg.ClientCAFile == "" {
+		return nil, fmt.Errorf("se requieren certFile, keyFile y clientCaFile")
+	}
+	if cfg.ReloadInterval <= 0 {
+		cfg.ReloadInterval = defaultTLSReloadInterval
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	r := &tlsReloader{
+		cfg:    cfg,
+		now:    time.Now,
+		logger: logger.Named("authn.tls"),
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+type tlsReloader struct {
+	cfg    ServerTLSConfig
+	now    func() time.Time
+	logger *zap.Logger
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	pool      *x509.CertPool
+	modTimes  [3]time.Time
+	checkedAt time.Time
+}
+
+// config construye un tls.Config que toma el certificado y las CAs vigentes en cada handshake.
+func (r *tlsReloader) config() *tls.Config {
+	clientAuth := tls.RequireAndVerifyClientCert
+	if r.cfg.ClientAuthOptional {
+		clientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: clientAuth,
+	}
+	// GetCertificate permite usar http.Server.ListenAndServeTLS("", "").
+	base.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		cert, _ := r.current()
+		return cert, nil
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cert, pool := r.current()
+		c := base.Clone()
+		c.GetConfigForClient = nil
+		c.Certificates = []tls.Certificate{*cert}
+		c.ClientCAs = pool
+		return c, nil
+	}
+
+	return base
+}
+
+// current devuelve el certificado y las CAs vigentes, recargándolos si pasó el
+// intervalo y alguno de los archivos cambió.
+func (r *tlsReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	due := r.now().Sub(r.checkedAt) >= r.cfg.ReloadInterval
+	r.mu.Unlock()
+
+	if due {
+		if err := r.reload(); err != nil {
+			r.logger.Error("error al recargar los certificados, se mantienen los anteriores", zap.Error(err))
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert, r.pool
+}
+
+func (r *tlsReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkedAt = r.now()
+
+	var modTimes [3]time.Time
+	for i, path := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.ClientCAFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	if r.cert != nil && modTimes == r.modTimes {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("error al leer el certificado del servidor: %w", err)
+	}
+
+	caPEM, err := os.ReadFile(r.cfg.ClientCAFile)
+	if err != nil {
+		return fmt.Errorf("error al leer las CAs de cliente: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("no se encontraron certificados en %s", r.cfg.ClientCAFile)
+	}
+
+	r.cert, r.pool, r.modTimes = &cert, pool, modTimes
+	r.logger.Info("certificados TLS cargados")
+	return nil
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/norlis/httpgate/pkg/kit/problem"
+)
+
+// Errores tipados que puede devolver un PayloadExtractor. AuthorizationMiddleware
+// los traduce a la respuesta correspondiente:
+//
+//	ErrMissingCredentials -> 401 con WWW-Authenticate
+//	ErrInvalidCredentials -> 401 con WWW-Authenticate (error="invalid_token" o el código indicado)
+//	ErrMalformedRequest   -> 400
+//	ErrAuthnUnavailable   -> 503, sin WWW-Authenticate: las credenciales no se pudieron verificar
+//
+// Cualquier otro error del extractor se responde como ErrMalformedRequest. La
+// denegación de la política se responde con 403.
+var (
+	ErrMissingCredentials = errors.New("missing credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrMalformedRequest   = errors.New("malformed request")
+	ErrAuthnUnavailable   = errors.New("authentication unavailable")
+)
+
+// Tipos (RFC 7807) de los problemas que responde el flujo de autorización.
+// Son estables para que los clientes puedan distinguirlos sin leer el título.
+const (
+	ProblemTypeMissingCredentials = "urn:httpgate:problem:missing-credentials"
+	ProblemTypeInvalidCredentials = "urn:httpgate:problem:invalid-credentials"
+	ProblemTypeMalformedRequest   = "urn:httpgate:problem:malformed-request"
+	ProblemTypeAccessDenied       = "urn:httpgate:problem:access-denied"
+	ProblemTypePolicyError        = "urn:httpgate:problem:policy-error"
+	ProblemTypeAuthnUnavailable   = "urn:httpgate:problem:authentication-unavailable"
+)
+
+// AuthenticationError es el error que devuelven los extractores cuando las
+// credenciales faltan o no son válidas; incluye lo necesario para construir
+// el desafío WWW-Authenticate.
+type AuthenticationError struct {
+	Kind        error  // ErrMissingCredentials o ErrInvalidCredentials
+	Scheme      string // esquema del desafío, p.ej. "Bearer"; vacío si no hay desafío (mTLS)
+	Realm       string
+	Code        string // código de error del esquema, p.ej. "invalid_token" (RFC 6750)
+	Description string
+	Err         error
+}
+
+// MissingCredentials indica que la petición no trae credenciales del esquema indicado.
+func MissingCredentials(scheme, realm, description string) *AuthenticationError {
+	return &AuthenticationError{Kind: ErrMissingCredentials, Scheme: scheme, Realm: realm, Description: description}
+}
+
+// InvalidCredentials indica que las credenciales del esquema indicado no son válidas.
+func InvalidCredentials(scheme, realm, description string, err error) *AuthenticationError {
+	return &AuthenticationError{Kind: ErrInvalidCredentials, Scheme: scheme, Realm: realm, Description: description, Err: err}
+}
+
+// AuthnUnavailable indica que las credenciales no se pudieron verificar por un
+// fallo del lado del servidor (el almacén de claves o el JWKS no responden).
+// No es un problema del cliente, así que no lleva desafío.
+func AuthnUnavailable(description string, err error) *AuthenticationError {
+	return &AuthenticationError{Kind: ErrAuthnUnavailable, Description: description, Err: err}
+}
+
+// MalformedRequest indica que la petición no se puede interpretar.
+func MalformedRequest(description string) error {
+	return fmt.Errorf("%w: %s", ErrMalformedRequest, description)
+}
+
+func (e *AuthenticationError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Description, e.Err)
+	}
+	return e.Description
+}
+
+func (e *AuthenticationError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// Challenge construye el valor de la cabecera WWW-Authenticate.
+func (e *AuthenticationError) Challenge() string {
+	var params []string
+	if e.Realm != "" {
+		params = append(params, fmt.Sprintf("realm=%q", e.Realm))
+	}
+	if e.Code != "" {
+		params = append(params, fmt.Sprintf("error=%q", e.Code))
+	}
+	if e.Description != "" && errors.Is(e.Kind, ErrInvalidCredentials) {
+		params = append(params, fmt.Sprintf("error_description=%q", e.Description))
+	}
+
+	if len(params) == 0 {
+		return e.Scheme
+	}
+	return e.Scheme + " " + strings.Join(params, ", ")
+}
+
+// respondExtractorError traduce el error del extractor a la respuesta
+// correspondiente. Un AuthenticationError sin esquema responde 401 sin
+// WWW-Authenticate: el cliente no puede reintentar con otra cabecera.
+func respondExtractorError(w http.ResponseWriter, r *http.Request, err error, challenge string) {
+	var authErr *AuthenticationError
+	if errors.As(err, &authErr) {
+		challenge = ""
+		if authErr.Scheme != "" {
+			challenge = authErr.Challenge()
+		}
+	}
+	if challenge != "" && (errors.Is(err, ErrMissingCredentials) || errors.Is(err, ErrInvalidCredentials)) {
+		w.Header().Set("WWW-Authenticate", challenge)
+	}
+
+	switch {
+	case errors.Is(err, ErrMissingCredentials):
+		problem.RespondError(w, problem.New("unauthenticated", http.StatusUnauthorized,
+			problem.WithType(ProblemTypeMissingCredentials),
+			problem.WithDetail(detailOf(err, authErr)),
+			problem.WithInstance(r),
+		))
+	case errors.Is(err, ErrInvalidCredentials):
+		problem.RespondError(w, problem.New("invalid credentials", http.StatusUnauthorized,
+			problem.WithType(ProblemTypeInvalidCredentials),
+			problem.WithDetail(detailOf(err, authErr)),
+			problem.WithInstance(r),
+		))
+	case errors.Is(err, ErrAuthnUnavailable):
+		problem.RespondError(w, problem.New("authentication unavailable", http.StatusServiceUnavailable,
+			problem.WithType(ProblemTypeAuthnUnavailable),
+			problem.WithDetail(detailOf(err, authErr)),
+			problem.WithInstance(r),
+		))
+	default:
+		problem.RespondError(w, problem.FromError(err, http.StatusBadRequest,
+			problem.WithType(ProblemTypeMalformedRequest),
+			problem.WithInstance(r),
+		))
+	}
+}
+
+// detailOf evita exponer el error interno cuando el extractor dio una descripción.
+func detailOf(err error, authErr *AuthenticationError) string {
+	if authErr != nil && authErr.Description != "" {
+		return authErr.Description
+	}
+	return err.Error()
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"net/http"
 	"strings"
@@ -9,20 +10,167 @@ import (
 	"github.com/norlis/httpgate/pkg/port"
 
 	"github.com/norlis/httpgate/pkg/kit/problem"
+	"go.uber.org/zap"
 )
 
 type PayloadExtractor func(r *http.Request) (map[string]any, error)
 
-func AuthorizationMiddleware(policyEnforcer port.PolicyEnforcer, extractor PayloadExtractor) func(http.Handler) http.Handler {
+// EnforcementMode define qué hace el middleware con la decisión de la política.
+type EnforcementMode string
+
+const (
+	// ModeEnforce bloquea las peticiones denegadas (comportamiento por defecto).
+	ModeEnforce EnforcementMode = "enforce"
+	// ModeShadow evalúa y registra la decisión pero deja pasar siempre la petición.
+	// Pensado para desplegar una política nueva sin afectar el tráfico.
+	ModeShadow EnforcementMode = "shadow"
+)
+
+type authzConfig struct {
+	query            string
+	mode             EnforcementMode
+	failClosedStatus int
+	failOpen         func(r *http.Request) bool
+	inputHeaders     []string
+	router           *http.ServeMux
+	challenge        string
+	explain          func(r *http.Request) bool
+	requirements     RequirementsResolver
+	logger           *zap.Logger
+}
+
+type AuthzOption func(*authzConfig)
+
+// WithQuery evalúa la consulta indicada (un nombre de opa.Config.Queries o una
+// consulta de rego) en lugar de la consulta por defecto del enforcer.
+func WithQuery(query string) AuthzOption {
+	return func(c *authzConfig) {
+		c.query = query
+	}
+}
+
+// WithEnforcementMode establece el modo de aplicación de la política.
+func WithEnforcementMode(mode EnforcementMode) AuthzOption {
+	return func(c *authzConfig) {
+		c.mode = mode
+	}
+}
+
+// WithFailClosedStatus establece el código que se devuelve cuando el motor de
+// políticas falla (500 por defecto, 503 si se prefiere que el cliente reintente).
+func WithFailClosedStatus(status int) AuthzOption {
+	return func(c *authzConfig) {
+		c.failClosedStatus = status
+	}
+}
+
+// WithFailOpen deja pasar las peticiones que cumplan el predicado cuando el
+// motor de políticas falla. Las denegaciones explícitas se siguen aplicando.
+func WithFailOpen(match func(r *http.Request) bool) AuthzOption {
+	return func(c *authzConfig) {
+		c.failOpen = match
+	}
+}
+
+// WithFailOpenPaths es un atajo de WithFailOpen para rutas que comienzan con alguno de los prefijos.
+func WithFailOpenPaths(prefixes ...string) AuthzOption {
+	return WithFailOpen(func(r *http.Request) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// WithInputHeaders indica qué cabeceras de la petición se envían a la política.
+// Por defecto no se envía ninguna, para no exponer credenciales ni cookies.
+func WithInputHeaders(names ...string) AuthzOption {
+	return func(c *authzConfig) {
+		for _, name := range names {
+			c.inputHeaders = append(c.inputHeaders, http.CanonicalHeaderKey(name))
+		}
+	}
+}
+
+// WithRouteResolver permite obtener el patrón de la ruta (y sus path values)
+// cuando el middleware envuelve a todo un ServeMux en lugar de a cada handler,
+// caso en que r.Pattern aún no está asignado.
+func WithRouteResolver(mux *http.ServeMux) AuthzOption {
+	return func(c *authzConfig) {
+		c.router = mux
+	}
+}
+
+// WithChallenge establece el desafío WWW-Authenticate que se envía con los 401
+// cuando el extractor no informa uno propio ("Bearer" por defecto).
+func WithChallenge(scheme, realm string) AuthzOption {
+	return func(c *authzConfig) {
+		c.challenge = (&AuthenticationError{Scheme: scheme, Realm: realm}).Challenge()
+	}
+}
+
+// WithExplain pide la explicación de la decisión (ver opa.Config.Explain) para
+// las peticiones que envían la cabecera con el valor token, y la incluye en el
+// 403. Solo para entornos que no son de producción: el 403 expone el input y
+// la traza de la política.
+func WithExplain(header, token string) AuthzOption {
+	return func(c *authzConfig) {
+		if header == "" || token == "" {
+			return
+		}
+		c.explain = func(r *http.Request) bool {
+			return subtle.ConstantTimeCompare([]byte(r.Header.Get(header)), []byte(token)) == 1
+		}
+	}
+}
+
+// WithAuthzLogger registra las decisiones en modo shadow y los fallos abiertos.
+func WithAuthzLogger(l *zap.Logger) AuthzOption {
+	return func(c *authzConfig) {
+		c.logger = l
+	}
+}
+
+func AuthorizationMiddleware(policyEnforcer port.PolicyEnforcer, extractor PayloadExtractor, opts ...AuthzOption) func(http.Handler) http.Handler {
+	cfg := &authzConfig{
+		mode:             ModeEnforce,
+		failClosedStatus: http.StatusInternalServerError,
+		failOpen:         func(*http.Request) bool { return false },
+		challenge:        "Bearer",
+		explain:          func(*http.Request) bool { return false },
+		logger:           zap.NewNop(),
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	logger := cfg.logger.Named("middleware.authz")
+	shadow := cfg.mode == ModeShadow
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 			payload, err := extractor(r)
 			if err != nil {
-				problem.RespondError(w, problem.FromError(err, http.StatusBadRequest, problem.WithInstance(r)))
+				if shadow {
+					logger.Warn("shadow: payload inválido", zap.String("uri", r.RequestURI), zap.Error(err))
+					next.ServeHTTP(w, r)
+					return
+				}
+				respondExtractorError(w, r, err, cfg.challenge)
 				return
 			}
 
+			// El principal queda disponible para los handlers con PrincipalFromContext.
+			ctx := ContextWithPrincipal(r.Context(), domain.NewPrincipal(payload))
+			if cfg.explain(r) {
+				ctx = port.WithExplain(ctx)
+			}
+			r = r.WithContext(ctx)
+
 			//action = "METODO:/ruta"
 			// GET:/api/person
 			action := fmt.Sprintf("%s:%s", strings.ToUpper(r.Method), r.URL.RequestURI())
@@ -30,25 +178,52 @@ func AuthorizationMiddleware(policyEnforcer port.PolicyEnforcer, extractor Paylo
 			input := domain.PolicyInput{
 				Payload: payload,
 				Action:  action,
+				Request: requestInput(r, cfg),
 			}
+			query := cfg.applyRequirements(r, &input)
 
 			// Esta llamada es agnóstica a si OPA es un servicio o una librería.
-			allowed, err := policyEnforcer.IsAllowed(r.Context(), input)
+			decision, err := port.DecideQuery(r.Context(), policyEnforcer, query, input)
 			if err != nil {
+				if shadow || cfg.failOpen(r) {
+					logger.Warn("fallo del motor de políticas, se permite la petición",
+						zap.String("action", action),
+						zap.Bool("shadow", shadow),
+						zap.Error(err),
+					)
+					next.ServeHTTP(w, r)
+					return
+				}
 				// Si hay un error al contactar o evaluar OPA, es más seguro denegar el acceso.
-				// Devolvemos un 500 Internal Server Error para indicar un fallo en el sistema.
-				problem.RespondError(w, problem.FromError(err, http.StatusInternalServerError, problem.WithInstance(r)))
+				// Devolvemos un 500 Internal Server Error (o el configurado) para indicar un fallo en el sistema.
+				problem.RespondError(w, problem.FromError(err, cfg.failClosedStatus,
+					problem.WithType(ProblemTypePolicyError),
+					problem.WithInstance(r),
+				))
+				return
+			}
+
+			if shadow {
+				if !decision.Allow {
+					logger.Warn("shadow: la petición sería denegada",
+						zap.String("action", action),
+						zap.String("decisionId", decision.ID),
+						zap.Strings("reasons", decision.Reasons),
+					)
+				}
+				next.ServeHTTP(w, r)
 				return
 			}
 
-			if !allowed {
+			// Las obligaciones de la política se aplican tanto si se permite como si se deniega.
+			for name, value := range decision.Obligations.Headers {
+				w.Header().Set(name, value)
+			}
+
+			if !decision.Allow {
 				// Si la política de OPA devuelve 'false', denegamos el acceso.
 				// Devolvemos un 403 Forbidden, que es el código estándar para un fallo de autorización.
-				p := problem.New("access denied", http.StatusForbidden,
-					problem.WithDetail("You do not have permission to perform this action."),
-					problem.WithInstance(r),
-				)
-				problem.RespondError(w, p)
+				problem.RespondError(w, deniedProblem(r, decision))
 				return
 			}
 
@@ -57,3 +232,24 @@ func AuthorizationMiddleware(policyEnforcer port.PolicyEnforcer, extractor Paylo
 		})
 	}
 }
+
+// deniedProblem construye el 403 incluyendo los motivos que haya informado la
+// política y, si se pidió con WithExplain, la explicación de la decisión.
+func deniedProblem(r *http.Request, decision domain.Decision) *problem.ProblemDetail {
+	detail := "You do not have permission to perform this action."
+	if len(decision.Reasons) > 0 {
+		detail = strings.Join(decision.Reasons, "; ")
+	}
+
+	opts := []problem.Option{
+		problem.WithType(ProblemTypeAccessDenied),
+		problem.WithDetail(detail),
+		problem.WithDecision(decision.ID),
+		problem.WithInstance(r),
+	}
+	if decision.Explanation != nil {
+		opts = append(opts, problem.WithExplanation(decision.Explanation))
+	}
+
+	return problem.New("access denied", http.StatusForbidden, opts...)
+}
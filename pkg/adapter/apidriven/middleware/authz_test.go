@@ -0,0 +1,424 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/norlis/httpgate/pkg/domain"
+	"github.com/norlis/httpgate/pkg/port"
+)
+
+type stubEnforcer struct {
+	decision    domain.Decision
+	explanation *domain.Explanation // solo si el contexto pide explicación
+	err         error
+	inputs      []domain.PolicyInput
+	queries     []string
+}
+
+func (s *stubEnforcer) IsAllowed(ctx context.Context, input domain.PolicyInput) (bool, error) {
+	decision, err := s.Decide(ctx, input)
+	return decision.Allow, err
+}
+
+func (s *stubEnforcer) Decide(ctx context.Context, input domain.PolicyInput) (domain.Decision, error) {
+	s.inputs = append(s.inputs, input)
+	decision := s.decision
+	if port.ExplainRequested(ctx) {
+		decision.Explanation = s.explanation
+	}
+	return decision, s.err
+}
+
+func (s *stubEnforcer) DecideQuery(ctx context.Context, query string, input domain.PolicyInput) (domain.Decision, error) {
+	s.queries = append(s.queries, query)
+	return s.Decide(ctx, input)
+}
+
+func noPayload(*http.Request) (map[string]any, error) {
+	return map[string]any{"roles": []string{}}, nil
+}
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func serve(t *testing.T, handler http.Handler, method, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestAuthorizationMiddleware_Modes(t *testing.T) {
+	errOpa := errors.New("opa unavailable")
+
+	tests := []struct {
+		name     string
+		enforcer *stubEnforcer
+		opts     []AuthzOption
+		target   string
+		want     int
+	}{
+		{name: "allow", enforcer: &stubEnforcer{decision: domain.Decision{Allow: true}}, target: "/api/test", want: http.StatusNoContent},
+		{name: "deny", enforcer: &stubEnforcer{}, target: "/api/test", want: http.StatusForbidden},
+		{name: "error fails closed", enforcer: &stubEnforcer{err: errOpa}, target: "/api/test", want: http.StatusInternalServerError},
+		{
+			name:     "error fails closed with custom status",
+			enforcer: &stubEnforcer{err: errOpa},
+			opts:     []AuthzOption{WithFailClosedStatus(http.StatusServiceUnavailable)},
+			target:   "/api/test",
+			want:     http.StatusServiceUnavailable,
+		},
+		{
+			name:     "error fails open on matching route",
+			enforcer: &stubEnforcer{err: errOpa},
+			opts:     []AuthzOption{WithFailOpenPaths("/api/public")},
+			target:   "/api/public/info",
+			want:     http.StatusNoContent,
+		},
+		{
+			name:     "error fails closed on other routes",
+			enforcer: &stubEnforcer{err: errOpa},
+			opts:     []AuthzOption{WithFailOpenPaths("/api/public")},
+			target:   "/api/private",
+			want:     http.StatusInternalServerError,
+		},
+		{
+			name:     "fail open does not bypass deny",
+			enforcer: &stubEnforcer{},
+			opts:     []AuthzOption{WithFailOpenPaths("/api/public")},
+			target:   "/api/public/info",
+			want:     http.StatusForbidden,
+		},
+		{
+			name:     "shadow lets denied requests through",
+			enforcer: &stubEnforcer{},
+			opts:     []AuthzOption{WithEnforcementMode(ModeShadow)},
+			target:   "/api/test",
+			want:     http.StatusNoContent,
+		},
+		{
+			name:     "shadow lets errors through",
+			enforcer: &stubEnforcer{err: errOpa},
+			opts:     []AuthzOption{WithEnforcementMode(ModeShadow)},
+			target:   "/api/test",
+			want:     http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := AuthorizationMiddleware(tt.enforcer, noPayload, tt.opts...)(okHandler())
+
+			w := serve(t, handler, http.MethodGet, tt.target)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if len(tt.enforcer.inputs) != 1 {
+				t.Errorf("policy evaluated %d times, want 1", len(tt.enforcer.inputs))
+			}
+		})
+	}
+}
+
+func TestAuthorizationMiddleware_WithQuery(t *testing.T) {
+	enforcer := &stubEnforcer{decision: domain.Decision{Allow: true}}
+
+	w := serve(t, AuthorizationMiddleware(enforcer, noPayload, WithQuery("admin"))(okHandler()), http.MethodGet, "/api/test")
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want 204", w.Code)
+	}
+	if len(enforcer.queries) != 1 || enforcer.queries[0] != "admin" {
+		t.Errorf("queries = %v, want [admin]", enforcer.queries)
+	}
+}
+
+func TestAuthorizationMiddleware_DeniedProblem(t *testing.T) {
+	enforcer := &stubEnforcer{decision: domain.Decision{
+		ID:          "d1",
+		Reasons:     []string{"tenant mismatch"},
+		Obligations: domain.Obligations{Headers: map[string]string{"X-Policy": "tenant"}},
+	}}
+
+	w := serve(t, AuthorizationMiddleware(enforcer, noPayload)(okHandler()), http.MethodGet, "/api/test")
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", w.Code)
+	}
+	if w.Header().Get("X-Policy") != "tenant" {
+		t.Errorf("X-Policy = %q, want tenant", w.Header().Get("X-Policy"))
+	}
+	body := w.Body.String()
+	for _, want := range []string{`"detail":"tenant mismatch"`, `"decisionId":"d1"`, `"type":"` + ProblemTypeAccessDenied + `"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body = %s, want it to contain %s", body, want)
+		}
+	}
+}
+
+func TestAuthorizationMiddleware_Explain(t *testing.T) {
+	enforcer := &stubEnforcer{
+		decision:    domain.Decision{ID: "d1"},
+		explanation: &domain.Explanation{Trace: []string{"Fail input.action == \"GET:/api/admin\""}},
+	}
+	handler := AuthorizationMiddleware(enforcer, noPayload, WithExplain("X-Debug-Explain", "s3cret"))(okHandler())
+
+	tests := []struct {
+		name  string
+		token string
+		want  bool
+	}{
+		{name: "without header", want: false},
+		{name: "wrong token", token: "guess", want: false},
+		{name: "privileged header", token: "s3cret", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/admin", nil)
+			if tt.token != "" {
+				req.Header.Set("X-Debug-Explain", tt.token)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("status = %d, want 403", w.Code)
+			}
+			if got := strings.Contains(w.Body.String(), `"explanation"`); got != tt.want {
+				t.Errorf("explanation in body = %v, want %v (body = %s)", got, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+type stubRequirements map[string]domain.Requirements
+
+func (s stubRequirements) Requirements(r *http.Request) (string, domain.Requirements, bool) {
+	pattern := r.Method + " " + r.URL.Path
+	req, ok := s[pattern]
+	return pattern, req, ok
+}
+
+func TestAuthorizationMiddleware_Requirements(t *testing.T) {
+	enforcer := &stubEnforcer{decision: domain.Decision{Allow: true}}
+	resolver := stubRequirements{
+		"GET /api/templates":  {Permissions: []string{"templates.view_all"}, Scopes: []string{"read"}},
+		"POST /api/templates": {Query: "templates"},
+	}
+	handler := AuthorizationMiddleware(enforcer, noPayload, WithRequirements(resolver), WithQuery("default"))(okHandler())
+
+	serve(t, handler, http.MethodGet, "/api/templates")
+	input := enforcer.inputs[0]
+	if input.Requirements == nil || input.Requirements.Permissions[0] != "templates.view_all" || input.Requirements.Scopes[0] != "read" {
+		t.Errorf("Requirements = %+v, want templates.view_all and read", input.Requirements)
+	}
+	if input.Request.Pattern != "GET /api/templates" || enforcer.queries[0] != "default" {
+		t.Errorf("pattern = %q, query = %q", input.Request.Pattern, enforcer.queries[0])
+	}
+
+	serve(t, handler, http.MethodPost, "/api/templates")
+	if enforcer.inputs[1].Requirements != nil || enforcer.queries[1] != "templates" {
+		t.Errorf("Requirements = %+v, query = %q, want no requirements and the route query", enforcer.inputs[1].Requirements, enforcer.queries[1])
+	}
+
+	serve(t, handler, http.MethodDelete, "/api/templates")
+	if enforcer.inputs[2].Requirements != nil || enforcer.inputs[2].Request.Pattern != "" || enforcer.queries[2] != "default" {
+		t.Errorf("unregistered route: input = %+v, query = %q", enforcer.inputs[2], enforcer.queries[2])
+	}
+}
+
+func TestAuthorizationMiddleware_ExtractorErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		opts      []AuthzOption
+		want      int
+		wantType  string
+		challenge string
+	}{
+		{
+			name:      "missing credentials",
+			err:       MissingCredentials("Bearer", "api", "missing bearer token"),
+			want:      http.StatusUnauthorized,
+			wantType:  ProblemTypeMissingCredentials,
+			challenge: `Bearer realm="api"`,
+		},
+		{
+			name:      "invalid credentials",
+			err:       &AuthenticationError{Kind: ErrInvalidCredentials, Scheme: "Bearer", Code: "invalid_token", Description: "token expired"},
+			want:      http.StatusUnauthorized,
+			wantType:  ProblemTypeInvalidCredentials,
+			challenge: `Bearer error="invalid_token", error_description="token expired"`,
+		},
+		{
+			name:      "wrapped sentinel uses default challenge",
+			err:       fmt.Errorf("api key: %w", ErrMissingCredentials),
+			opts:      []AuthzOption{WithChallenge("ApiKey", "internal")},
+			want:      http.StatusUnauthorized,
+			wantType:  ProblemTypeMissingCredentials,
+			challenge: `ApiKey realm="internal"`,
+		},
+		{
+			name:      "empty scheme skips the challenge",
+			err:       MissingCredentials("", "", "verified client certificate required"),
+			want:      http.StatusUnauthorized,
+			wantType:  ProblemTypeMissingCredentials,
+			challenge: "",
+		},
+		{
+			name:     "authentication unavailable",
+			err:      AuthnUnavailable("api key could not be verified", errors.New("connection refused")),
+			want:     http.StatusServiceUnavailable,
+			wantType: ProblemTypeAuthnUnavailable,
+		},
+		{
+			name:     "malformed request",
+			err:      MalformedRequest("invalid json body"),
+			want:     http.StatusBadRequest,
+			wantType: ProblemTypeMalformedRequest,
+		},
+		{
+			name:     "untyped error",
+			err:      errors.New("boom"),
+			want:     http.StatusBadRequest,
+			wantType: ProblemTypeMalformedRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enforcer := &stubEnforcer{decision: domain.Decision{Allow: true}}
+			extractor := func(*http.Request) (map[string]any, error) { return nil, tt.err }
+
+			w := serve(t, AuthorizationMiddleware(enforcer, extractor, tt.opts...)(okHandler()), http.MethodGet, "/api/test")
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != tt.challenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.challenge)
+			}
+			if body := w.Body.String(); !strings.Contains(body, `"type":"`+tt.wantType+`"`) {
+				t.Errorf("body = %s, want type %s", body, tt.wantType)
+			}
+			if len(enforcer.inputs) != 0 {
+				t.Errorf("policy evaluated %d times, want 0", len(enforcer.inputs))
+			}
+		})
+	}
+}
+
+func TestAuthorizationMiddleware_RequestInput(t *testing.T) {
+	enforcer := &stubEnforcer{decision: domain.Decision{Allow: true}}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /items/{id}/{rest...}", okHandler())
+	handler := AuthorizationMiddleware(enforcer, noPayload,
+		WithRouteResolver(mux),
+		WithInputHeaders("x-tenant"),
+	)(mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/items/a%2Fb/c/d?v=1&v=2", nil)
+	req.Header.Set("X-Tenant", "acme")
+	req.Header.Set("Authorization", "Bearer secret")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	in := enforcer.inputs[0].Request
+	if in.Method != http.MethodGet || in.Path != "/items/a/b/c/d" || in.Pattern != "GET /items/{id}/{rest...}" {
+		t.Errorf("request = %+v", in)
+	}
+	if in.PathValues["id"] != "a/b" || in.PathValues["rest"] != "c/d" {
+		t.Errorf("PathValues = %v, want id=a/b rest=c/d", in.PathValues)
+	}
+	if len(in.Query["v"]) != 2 {
+		t.Errorf("Query = %v, want v=[1 2]", in.Query)
+	}
+	if in.Headers["X-Tenant"] != "acme" || len(in.Headers) != 1 {
+		t.Errorf("Headers = %v, want only X-Tenant", in.Headers)
+	}
+	if in.RemoteIP != "192.0.2.1" {
+		t.Errorf("RemoteIP = %s, want 192.0.2.1", in.RemoteIP)
+	}
+}
+
+func TestAuthorizationMiddleware_Principal(t *testing.T) {
+	enforcer := &stubEnforcer{decision: domain.Decision{Allow: true}}
+	extractor := func(*http.Request) (map[string]any, error) {
+		return map[string]any{
+			"sub":        "user-1",
+			"roles":      []any{"admin"},
+			"scopes":     []string{"read"},
+			"authScheme": "jwt",
+			"tenant":     "acme",
+		}, nil
+	}
+
+	var got domain.Principal
+	var ok bool
+	handler := AuthorizationMiddleware(enforcer, extractor)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok = PrincipalFromContext(r.Context())
+	}))
+	serve(t, handler, http.MethodGet, "/api/test")
+
+	if !ok {
+		t.Fatal("PrincipalFromContext() ok = false, want true")
+	}
+	if got.Subject != "user-1" || got.AuthScheme != "jwt" || !got.HasRole("admin") || !got.HasScope("read") {
+		t.Errorf("principal = %+v", got)
+	}
+	if got.Claims["tenant"] != "acme" {
+		t.Errorf("claims = %v, want tenant acme", got.Claims)
+	}
+
+	if _, ok := PrincipalFromContext(httptest.NewRequest(http.MethodGet, "/", nil).Context()); ok {
+		t.Error("PrincipalFromContext() without middleware ok = true, want false")
+	}
+}
+
+func TestResourceAuthorizer(t *testing.T) {
+	doc := map[string]any{"owner": "user-2", "tenant": "acme"}
+	r := httptest.NewRequest(http.MethodGet, "/api/documents/7", nil)
+	r = r.WithContext(ContextWithPrincipal(r.Context(), domain.NewPrincipal(map[string]any{"sub": "user-1"})))
+
+	tests := []struct {
+		name     string
+		enforcer *stubEnforcer
+		want     int // 0 si se permite
+	}{
+		{name: "allow", enforcer: &stubEnforcer{decision: domain.Decision{Allow: true}}},
+		{name: "deny", enforcer: &stubEnforcer{decision: domain.Decision{Reasons: []string{"not the owner"}}}, want: http.StatusForbidden},
+		{name: "error", enforcer: &stubEnforcer{err: errors.New("opa unavailable")}, want: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authz := NewResourceAuthorizer(tt.enforcer, "data.documents.allow")
+
+			p := authz.Authorize(r, "documents:read", doc)
+			switch {
+			case tt.want == 0 && p != nil:
+				t.Errorf("Authorize() = %v, want nil", p)
+			case tt.want != 0 && (p == nil || p.Status != tt.want):
+				t.Errorf("Authorize() = %v, want status %d", p, tt.want)
+			}
+
+			if len(tt.enforcer.queries) != 1 || tt.enforcer.queries[0] != "data.documents.allow" {
+				t.Fatalf("queries = %v, want [data.documents.allow]", tt.enforcer.queries)
+			}
+			input := tt.enforcer.inputs[0]
+			if input.Action != "documents:read" || input.Payload["sub"] != "user-1" || input.Resource == nil {
+				t.Errorf("input = %+v", input)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/norlis/httpgate/pkg/domain"
+)
+
+// requestInput construye la sección estructurada de la petición del PolicyInput.
+func requestInput(r *http.Request, cfg *authzConfig) *domain.RequestInput {
+	in := &domain.RequestInput{
+		Method:   strings.ToUpper(r.Method),
+		Path:     r.URL.Path,
+		Segments: splitPath(r.URL.Path),
+		Pattern:  r.Pattern,
+	}
+
+	if in.Pattern == "" && cfg.router != nil {
+		_, in.Pattern = cfg.router.Handler(r)
+	}
+	if in.Pattern != "" {
+		in.PathValues = pathValues(in.Pattern, r.URL.EscapedPath())
+	}
+
+	if query := r.URL.Query(); len(query) > 0 {
+		in.Query = query
+	}
+
+	for _, name := range cfg.inputHeaders {
+		if value := r.Header.Get(name); value != "" {
+			if in.Headers == nil {
+				in.Headers = make(map[string]string, len(cfg.inputHeaders))
+			}
+			in.Headers[name] = value
+		}
+	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		in.RemoteIP = host
+	} else {
+		in.RemoteIP = r.RemoteAddr
+	}
+
+	// Solo se expone el certificado si el servidor verificó la cadena.
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.PeerCertificates) > 0 {
+		in.ClientCertSubject = r.TLS.PeerCertificates[0].Subject.String()
+	}
+
+	return in
+}
+
+func splitPath(path string) []string {
+	segments := []string{}
+	for _, s := range strings.Split(path, "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+// pathValues extrae los comodines ({id}, {rest...}) del patrón del ServeMux
+// comparándolo con la ruta. Se calcula aquí porque el middleware puede ejecutarse
+// antes de que el ServeMux haya asignado los valores a la petición.
+func pathValues(pattern, escapedPath string) map[string]string {
+	// "GET example.com/items/{id}" -> "/items/{id}"
+	if i := strings.IndexByte(pattern, ' '); i >= 0 {
+		pattern = strings.TrimSpace(pattern[i+1:])
+	}
+	if i := strings.IndexByte(pattern, '/'); i > 0 {
+		pattern = pattern[i:]
+	}
+
+	patternSegments := strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.TrimPrefix(escapedPath, "/"), "/")
+
+	values := make(map[string]string)
+	for i, segment := range patternSegments {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") || i >= len(pathSegments) {
+			continue
+		}
+
+		name := strings.TrimSuffix(strings.TrimPrefix(segment, "{"), "}")
+		if name == "$" {
+			continue
+		}
+
+		raw := pathSegments[i]
+		if rest, ok := strings.CutSuffix(name, "..."); ok {
+			name, raw = rest, strings.Join(pathSegments[i:], "/")
+		}
+
+		if value, err := url.PathUnescape(raw); err == nil {
+			values[name] = value
+		}
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/norlis/httpgate/pkg/domain"
+)
+
+type ctxPrincipalKey struct{}
+
+// ContextWithPrincipal guarda el principal en el contexto. AuthorizationMiddleware
+// lo hace con el payload del extractor; sirve también para pruebas de handlers.
+func ContextWithPrincipal(ctx context.Context, principal domain.Principal) context.Context {
+	return context.WithValue(ctx, ctxPrincipalKey{}, principal)
+}
+
+// PrincipalFromContext devuelve el principal autenticado por AuthorizationMiddleware.
+// ok es false si la petición no pasó por el middleware o el extractor falló.
+func PrincipalFromContext(ctx context.Context) (principal domain.Principal, ok bool) {
+	if ctx == nil {
+		return domain.Principal{}, false
+	}
+	principal, ok = ctx.Value(ctxPrincipalKey{}).(domain.Principal)
+	return principal, ok
+}
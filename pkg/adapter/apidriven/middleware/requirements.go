@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/norlis/httpgate/pkg/domain"
+)
+
+// RequirementsResolver obtiene el patrón de la ruta que atiende la petición y
+// los requisitos que declaró al registrarse. Lo implementa routes.Registry.
+type RequirementsResolver interface {
+	Requirements(r *http.Request) (pattern string, req domain.Requirements, ok bool)
+}
+
+// WithRequirements envía a la política los requisitos declarados por la ruta
+// (input.requirements) y, si la ruta lo indica, la decide con su propia
+// consulta. También completa input.request.pattern cuando el middleware
+// envuelve a todo el ServeMux.
+func WithRequirements(resolver RequirementsResolver) AuthzOption {
+	return func(c *authzConfig) {
+		c.requirements = resolver
+	}
+}
+
+// applyRequirements agrega al input los requisitos de la ruta y devuelve la
+// consulta con la que se decide.
+func (c *authzConfig) applyRequirements(r *http.Request, input *domain.PolicyInput) string {
+	if c.requirements == nil {
+		return c.query
+	}
+
+	pattern, req, ok := c.requirements.Requirements(r)
+	if !ok {
+		return c.query
+	}
+
+	if input.Request.Pattern == "" {
+		input.Request.Pattern = pattern
+		input.Request.PathValues = pathValues(pattern, r.URL.EscapedPath())
+	}
+	if len(req.Permissions) > 0 || len(req.Scopes) > 0 {
+		// La consulta elige la política; la política no la recibe en el input.
+		input.Requirements = &domain.Requirements{Permissions: req.Permissions, Scopes: req.Scopes}
+	}
+	if req.Query != "" {
+		return req.Query
+	}
+	return c.query
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/norlis/httpgate/pkg/domain"
+	"github.com/norlis/httpgate/pkg/kit/problem"
+	"github.com/norlis/httpgate/pkg/port"
+)
+
+// ResourceAuthorizer decide desde los handlers sobre un recurso ya cargado
+// (dueño, tenant, estado), algo que AuthorizationMiddleware no puede hacer
+// porque decide antes de que el handler se ejecute. Usa el mismo enforcer, así
+// que las decisiones pasan por la misma caché y el mismo registro de decisiones.
+//
+//	doc, _ := repo.Get(id)
+//	if p := documents.Authorize(r, "documents:read", doc); p != nil {
+//		problem.RespondError(w, p)
+//		return
+//	}
+type ResourceAuthorizer struct {
+	enforcer port.PolicyEnforcer
+	query    string
+}
+
+// NewResourceAuthorizer evalúa la consulta indicada (un nombre de opa.Config.Queries
+// o una consulta de rego, p.ej. "data.documents.allow") o, si está vacía, la
+// consulta por defecto del enforcer. La consulta recibe:
+//
+//	{"payload": {...principal...}, "action": "documents:read", "resource": {...}, "request": {...}}
+func NewResourceAuthorizer(enforcer port.PolicyEnforcer, query string) *ResourceAuthorizer {
+	return &ResourceAuthorizer{enforcer: enforcer, query: query}
+}
+
+// Decide evalúa la acción sobre el recurso para el principal de la petición.
+func (a *ResourceAuthorizer) Decide(r *http.Request, action string, resource any) (domain.Decision, error) {
+	payload := map[string]any{}
+	if principal, ok := PrincipalFromContext(r.Context()); ok && principal.Claims != nil {
+		payload = principal.Claims
+	}
+
+	input := domain.PolicyInput{
+		Payload:  payload,
+		Action:   action,
+		Request:  requestInput(r, &authzConfig{}),
+		Resource: resource,
+	}
+
+	return port.DecideQuery(r.Context(), a.enforcer, a.query, input)
+}
+
+// Authorize devuelve nil si la política permite la acción, o el problema que
+// debe responder el handler: 403 si se deniega y 500 si el motor falla.
+func (a *ResourceAuthorizer) Authorize(r *http.Request, action string, resource any) *problem.ProblemDetail {
+	decision, err := a.Decide(r, action, resource)
+	if err != nil {
+		return problem.FromError(err, http.StatusInternalServerError,
+			problem.WithType(ProblemTypePolicyError),
+			problem.WithInstance(r),
+		)
+	}
+
+	if !decision.Allow {
+		return deniedProblem(r, decision)
+	}
+
+	return nil
+}
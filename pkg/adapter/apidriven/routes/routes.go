@@ -0,0 +1,248 @@
+// Package routes registra los patrones de un http.ServeMux para poder
+// listarlos y cruzarlos con los permisos cargados en OPA (ver
+// pkg/application/coverage), que son expresiones regulares y se desfasan de
+// las rutas reales con facilidad.
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/norlis/httpgate/pkg/application/coverage"
+	"github.com/norlis/httpgate/pkg/domain"
+	"github.com/norlis/httpgate/pkg/kit/problem"
+)
+
+// Registry envuelve a un http.ServeMux y recuerda cada patrón registrado a
+// través de él. Los grupos (Group) comparten el registro con el padre y
+// guardan sus patrones con el prefijo completo.
+type Registry struct {
+	mux    *http.ServeMux
+	prefix string
+	set    *routeSet
+}
+
+type routeSet struct {
+	mu           sync.RWMutex
+	patterns     []string
+	requirements map[string]domain.Requirements
+
+	// index tiene todos los patrones con el prefijo completo, para resolver la
+	// ruta de una petición antes de que pase por los grupos (ver Requirements).
+	index *http.ServeMux
+}
+
+// RouteOption declara los requisitos de una ruta al registrarla.
+type RouteOption func(*domain.Requirements)
+
+// RequirePermissions declara los permisos lógicos que exige la ruta, p.ej.
+// "templates.view_all". La política los recibe en input.requirements.permissions.
+func RequirePermissions(permissions ...string) RouteOption {
+	return func(req *domain.Requirements) {
+		req.Permissions = append(req.Permissions, permissions...)
+	}
+}
+
+// RequireScopes declara los scopes que debe tener el principal. La política
+// los recibe en input.requirements.scopes.
+func RequireScopes(scopes ...string) RouteOption {
+	return func(req *domain.Requirements) {
+		req.Scopes = append(req.Scopes, scopes...)
+	}
+}
+
+// WithQuery decide la ruta con otra consulta (un nombre de opa.Config.Queries
+// o una consulta de rego) en lugar de la del middleware.
+func WithQuery(query string) RouteOption {
+	return func(req *domain.Requirements) {
+		req.Query = query
+	}
+}
+
+// NewRegistry registra las rutas en mux, o en un ServeMux nuevo si es nil.
+func NewRegistry(mux *http.ServeMux) *Registry {
+	if mux == nil {
+		mux = http.NewServeMux()
+	}
+	return &Registry{
+		mux: mux,
+		set: &routeSet{
+			requirements: map[string]domain.Requirements{},
+			index:        http.NewServeMux(),
+		},
+	}
+}
+
+// Handle registra el handler en el ServeMux y guarda el patrón con los
+// requisitos declarados, que AuthorizationMiddleware envía a la política si
+// se configura con middleware.WithRequirements.
+//
+//	api.Handle("GET /templates", list, routes.RequirePermissions("templates.view_all"))
+func (r *Registry) Handle(pattern string, handler http.Handler, opts ...RouteOption) {
+	r.mux.Handle(pattern, handler)
+
+	full := withPrefix(r.prefix, pattern)
+	r.set.index.Handle(full, http.NotFoundHandler())
+
+	var req domain.Requirements
+	for _, opt := range opts {
+		opt(&req)
+	}
+
+	r.set.mu.Lock()
+	defer r.set.mu.Unlock()
+	r.set.patterns = append(r.set.patterns, full)
+	if len(opts) > 0 {
+		r.set.requirements[full] = req
+	}
+}
+
+// HandleFunc registra la función en el ServeMux y guarda el patrón.
+func (r *Registry) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request), opts ...RouteOption) {
+	r.Handle(pattern, http.HandlerFunc(handler), opts...)
+}
+
+// Requirements devuelve el patrón completo de la ruta que atiende la petición
+// y los requisitos que declaró. Resuelve con la ruta completa, así funciona
+// aunque el middleware se ejecute antes del ServeMux o fuera de un grupo.
+func (r *Registry) Requirements(req *http.Request) (string, domain.Requirements, bool) {
+	_, pattern := r.set.index.Handler(req)
+	if pattern == "" {
+		return "", domain.Requirements{}, false
+	}
+
+	r.set.mu.RLock()
+	defer r.set.mu.RUnlock()
+	return pattern, r.set.requirements[pattern], true
+}
+
+// ServeHTTP delega en el ServeMux.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mux.ServeHTTP(w, req)
+}
+
+// Mux devuelve el ServeMux envuelto, p.ej. para middleware.WithRouteResolver.
+func (r *Registry) Mux() *http.ServeMux {
+	return r.mux
+}
+
+// Group crea un registro con su propio ServeMux para las rutas que se sirven
+// bajo prefix, p.ej. "/api". Sus patrones se registran sin el prefijo
+// ("GET /items/{id}") y se guardan con él ("GET /api/items/{id}"). Se monta en
+// el padre con Mount.
+func (r *Registry) Group(prefix string) *Registry {
+	return &Registry{
+		mux:    http.NewServeMux(),
+		prefix: r.prefix + strings.TrimSuffix(prefix, "/"),
+		set:    r.set,
+	}
+}
+
+// Mount sirve el grupo bajo su prefijo quitándolo de la ruta, envuelto en los
+// middlewares indicados (el primero es el más externo). El patrón del montaje
+// no se guarda: las rutas son las del grupo.
+func (r *Registry) Mount(group *Registry, middlewares ...func(http.Handler) http.Handler) {
+	prefix := strings.TrimPrefix(group.prefix, r.prefix)
+
+	var handler http.Handler = http.StripPrefix(prefix, group.mux)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	r.mux.Handle(prefix+"/", handler)
+}
+
+// Patterns devuelve los patrones registrados, ordenados.
+func (r *Registry) Patterns() []string {
+	r.set.mu.RLock()
+	defer r.set.mu.RUnlock()
+
+	patterns := make([]string, len(r.set.patterns))
+	copy(patterns, r.set.patterns)
+	sort.Strings(patterns)
+	return patterns
+}
+
+// Routes devuelve los patrones registrados como coverage.Route, con los
+// permisos que declaró cada uno.
+func (r *Registry) Routes() []coverage.Route {
+	patterns := r.Patterns()
+
+	r.set.mu.RLock()
+	defer r.set.mu.RUnlock()
+
+	routes := make([]coverage.Route, len(patterns))
+	for i, pattern := range patterns {
+		routes[i] = coverage.ParseRoute(pattern)
+		routes[i].Requires = r.set.requirements[pattern].Permissions
+		routes[i].Query = r.set.requirements[pattern].Query
+	}
+	return routes
+}
+
+// Coverage cruza las rutas registradas con los permisos, roles y whitelist
+// que evalúa ev (p.ej. un *opa.SdkClient).
+func (r *Registry) Coverage(ctx context.Context, ev coverage.Evaluator) (coverage.Report, error) {
+	rules, err := coverage.LoadRules(ctx, ev)
+	if err != nil {
+		return coverage.Report{}, err
+	}
+	return coverage.Check(r.Routes(), rules)
+}
+
+// Inventory es la respuesta de Handler.
+type Inventory struct {
+	Routes       []string                       `json:"routes"`
+	Requirements map[string]domain.Requirements `json:"requirements,omitempty"` // por patrón, solo las rutas que declaran requisitos
+	Coverage     *coverage.Report               `json:"coverage,omitempty"`
+}
+
+// Handler expone el inventario de rutas en JSON y, si ev no es nil, el reporte
+// de cobertura. Es un endpoint de administración: expone la estructura de
+// permisos, así que debe registrarse detrás de autorización o solo en
+// entornos internos.
+func (r *Registry) Handler(ev coverage.Evaluator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		inventory := Inventory{Routes: r.Patterns(), Requirements: r.declared()}
+
+		if ev != nil {
+			report, err := r.Coverage(req.Context(), ev)
+			if err != nil {
+				problem.RespondError(w, problem.FromError(err, http.StatusInternalServerError, problem.WithInstance(req)))
+				return
+			}
+			inventory.Coverage = &report
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(inventory)
+	})
+}
+
+func (r *Registry) declared() map[string]domain.Requirements {
+	r.set.mu.RLock()
+	defer r.set.mu.RUnlock()
+
+	declared := make(map[string]domain.Requirements, len(r.set.requirements))
+	for pattern, req := range r.set.requirements {
+		declared[pattern] = req
+	}
+	return declared
+}
+
+// withPrefix inserta el prefijo del grupo en la ruta del patrón, conservando
+// el método y el host si los tiene.
+func withPrefix(prefix, pattern string) string {
+	if prefix == "" {
+		return pattern
+	}
+	i := strings.Index(pattern, "/")
+	if i < 0 {
+		return pattern
+	}
+	return pattern[:i] + prefix + pattern[i:]
+}
@@ -0,0 +1,118 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/norlis/httpgate/pkg/domain"
+)
+
+// stubData devuelve los documentos de datos por consulta, como opa.SdkClient.Eval.
+type stubData map[string]any
+
+func (s stubData) Eval(_ context.Context, query string, _ domain.PolicyInput) (any, error) {
+	return s[query], nil
+}
+
+func ok(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestRegistry(t *testing.T) {
+	router := NewRegistry(nil)
+	router.HandleFunc("GET /health", ok)
+
+	api := router.Group("/api")
+	api.HandleFunc("GET /items/{id}", ok)
+	api.HandleFunc("DELETE /items/{id}", ok)
+
+	var mounted bool
+	router.Mount(api, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mounted = true
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	want := []string{"DELETE /api/items/{id}", "GET /api/items/{id}", "GET /health"}
+	if got := router.Patterns(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Patterns() = %v, want %v", got, want)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/items/42", nil))
+	if w.Code != http.StatusNoContent || !mounted {
+		t.Errorf("DELETE /api/items/42 = %d (middleware %v), want 204 through the middleware", w.Code, mounted)
+	}
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	router := NewRegistry(nil)
+	router.HandleFunc("GET /health", ok)
+	router.HandleFunc("DELETE /items/{id}", ok, WithQuery("data.items.delete"))
+
+	data := stubData{
+		"data.permissions": map[string]any{"items.read": []any{"GET:/items/[0-9]+$"}},
+		"data.roles":       map[string]any{"viewer": []any{"items.read"}},
+		"data.whitelist":   []any{"GET:/health$"},
+	}
+
+	w := httptest.NewRecorder()
+	router.Handler(data).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/routes", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+
+	var got Inventory
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Routes) != 2 || got.Coverage == nil {
+		t.Fatalf("Handler() = %+v, want routes and coverage", got)
+	}
+	if len(got.Coverage.Uncovered) != 1 || got.Coverage.Uncovered[0].Path != "/items/{id}" {
+		t.Errorf("Uncovered = %v, want DELETE /items/{id}", got.Coverage.Uncovered)
+	}
+	if len(got.Coverage.UnusedPatterns) != 1 || got.Coverage.UnusedPatterns[0].Permission != "items.read" {
+		t.Errorf("UnusedPatterns = %v, want items.read", got.Coverage.UnusedPatterns)
+	}
+	if q := got.Requirements["DELETE /items/{id}"].Query; q != "data.items.delete" {
+		t.Errorf("Requirements query = %q, want data.items.delete", q)
+	}
+	if q := got.Coverage.Uncovered[0].Query; q != "data.items.delete" {
+		t.Errorf("Uncovered query = %q, want data.items.delete", q)
+	}
+}
+
+func TestRegistry_Requirements(t *testing.T) {
+	router := NewRegistry(nil)
+	api := router.Group("/api")
+	api.HandleFunc("GET /templates/{id}", ok, RequirePermissions("templates.view_all"), RequireScopes("read"))
+	api.HandleFunc("DELETE /templates/{id}", ok)
+	router.Mount(api)
+
+	pattern, req, found := router.Requirements(httptest.NewRequest(http.MethodGet, "/api/templates/7", nil))
+	if !found || pattern != "GET /api/templates/{id}" {
+		t.Fatalf("Requirements() = %q, %v, want GET /api/templates/{id}", pattern, found)
+	}
+	if !reflect.DeepEqual(req, domain.Requirements{Permissions: []string{"templates.view_all"}, Scopes: []string{"read"}}) {
+		t.Errorf("Requirements() = %+v", req)
+	}
+
+	if _, req, found := router.Requirements(httptest.NewRequest(http.MethodDelete, "/api/templates/7", nil)); !found || len(req.Permissions) != 0 {
+		t.Errorf("Requirements() = %+v, %v, want a route without requirements", req, found)
+	}
+	if _, _, found := router.Requirements(httptest.NewRequest(http.MethodGet, "/other", nil)); found {
+		t.Error("Requirements() found an unregistered route")
+	}
+
+	for _, route := range router.Routes() {
+		if route.Method == http.MethodGet && !reflect.DeepEqual(route.Requires, []string{"templates.view_all"}) {
+			t.Errorf("Routes() = %+v, want the declared permissions", route)
+		}
+	}
+}
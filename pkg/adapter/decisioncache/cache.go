@@ -0,0 +1,227 @@
+// Package decisioncache evita evaluar la política repetidamente para el mismo
+// input, guardando las decisiones en una caché LRU con expiración.
+package decisioncache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/norlis/httpgate/pkg/domain"
+	"github.com/norlis/httpgate/pkg/port"
+)
+
+const (
+	defaultMaxEntries = 10000
+	defaultTTL        = time.Minute
+)
+
+type Config struct {
+	MaxEntries int           `yaml:"maxEntries"` // por defecto 10000
+	TTL        time.Duration `yaml:"ttl"`        // por defecto 1m
+}
+
+// Stats son los contadores acumulados de la caché.
+type Stats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Size      int    `json:"size"`
+}
+
+type entry struct {
+	key       [sha256.Size]byte
+	decision  domain.Decision
+	expiresAt time.Time
+}
+
+// Enforcer decora un PolicyEnforcer con una caché de decisiones. Los errores
+// de evaluación no se guardan.
+type Enforcer struct {
+	next port.PolicyEnforcer
+	cfg  Config
+	now  func() time.Time
+
+	mu       sync.Mutex
+	items    map[[sha256.Size]byte]*list.Element
+	order    *list.List // el frente es el más reciente
+	revision string
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+func NewEnforcer(next port.PolicyEnforcer, cfg Config) *Enforcer {
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = defaultMaxEntries
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaultTTL
+	}
+
+	return &Enforcer{
+		next:  next,
+		cfg:   cfg,
+		now:   time.Now,
+		items: make(map[[sha256.Size]byte]*list.Element),
+		order: list.New(),
+	}
+}
+
+func (e *Enforcer) Decide(ctx context.Context, input domain.PolicyInput) (domain.Decision, error) {
+	return e.DecideQuery(ctx, "", input)
+}
+
+// DecideQuery cachea también las consultas con nombre; la consulta forma parte de la clave.
+// Las decisiones que piden explicación (port.WithExplain) siempre se evalúan.
+func (e *Enforcer) DecideQuery(ctx context.Context, query string, input domain.PolicyInput) (domain.Decision, error) {
+	key, ok := cacheKey(query, input)
+	if !ok || port.ExplainRequested(ctx) {
+		return port.DecideQuery(ctx, e.next, query, input)
+	}
+
+	if decision, ok := e.get(key); ok {
+		e.hits.Add(1)
+		// Cada petición conserva su propio identificador para la auditoría.
+		decision.ID = domain.NewDecisionID()
+		return decision, nil
+	}
+	e.misses.Add(1)
+
+	decision, err := port.DecideQuery(ctx, e.next, query, input)
+	if err != nil {
+		return decision, err
+	}
+
+	e.put(key, decision)
+	return decision, nil
+}
+
+func (e *Enforcer) IsAllowed(ctx context.Context, input domain.PolicyInput) (bool, error) {
+	decision, err := e.Decide(ctx, input)
+	return decision.Allow, err
+}
+
+// Filter no se cachea: se delega en el enforcer decorado.
+func (e *Enforcer) Filter(ctx context.Context, query string, input domain.PolicyInput) (domain.Filter, error) {
+	return port.Filter(ctx, e.next, query, input)
+}
+
+// Revision propaga la revisión del enforcer decorado (port.Revisioner).
+func (e *Enforcer) Revision() string {
+	return port.Revision(e.next)
+}
+
+// Invalidate descarta todas las decisiones guardadas.
+func (e *Enforcer) Invalidate() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.purge()
+}
+
+func (e *Enforcer) Stats() Stats {
+	e.mu.Lock()
+	size := e.order.Len()
+	e.mu.Unlock()
+
+	return Stats{
+		Hits:      e.hits.Load(),
+		Misses:    e.misses.Load(),
+		Evictions: e.evictions.Load(),
+		Size:      size,
+	}
+}
+
+func (e *Enforcer) get(key [sha256.Size]byte) (domain.Decision, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.checkRevision()
+
+	el, ok := e.items[key]
+	if !ok {
+		return domain.Decision{}, false
+	}
+
+	item := el.Value.(*entry)
+	if e.now().After(item.expiresAt) {
+		e.order.Remove(el)
+		delete(e.items, key)
+		return domain.Decision{}, false
+	}
+
+	e.order.MoveToFront(el)
+	return cloneDecision(item.decision), true
+}
+
+func (e *Enforcer) put(key [sha256.Size]byte, decision domain.Decision) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Una decisión tomada con otra revisión ya no es válida.
+	if decision.Revision != "" && e.revision != "" && decision.Revision != e.revision {
+		return
+	}
+
+	item := &entry{key: key, decision: cloneDecision(decision), expiresAt: e.now().Add(e.cfg.TTL)}
+	if el, ok := e.items[key]; ok {
+		el.Value = item
+		e.order.MoveToFront(el)
+		return
+	}
+
+	e.items[key] = e.order.PushFront(item)
+	for e.order.Len() > e.cfg.MaxEntries {
+		oldest := e.order.Back()
+		e.order.Remove(oldest)
+		delete(e.items, oldest.Value.(*entry).key)
+		e.evictions.Add(1)
+	}
+}
+
+// checkRevision vacía la caché si el enforcer recargó sus políticas. Funciona
+// si el enforcer decorado implementa port.Revisioner, como opa.SdkClient y los
+// decoradores de este módulo. Debe llamarse con el mutex tomado.
+func (e *Enforcer) checkRevision() {
+	if revision := port.Revision(e.next); revision != e.revision {
+		e.revision = revision
+		e.purge()
+	}
+}
+
+func (e *Enforcer) purge() {
+	e.items = make(map[[sha256.Size]byte]*list.Element)
+	e.order.Init()
+}
+
+// cloneDecision copia los motivos y las obligaciones: la decisión guardada se
+// comparte entre peticiones y quien la recibe puede modificarla.
+func cloneDecision(decision domain.Decision) domain.Decision {
+	decision.Reasons = slices.Clone(decision.Reasons)
+	decision.Obligations.Headers = maps.Clone(decision.Obligations.Headers)
+	return decision
+}
+
+// cacheKey resume la consulta y el input normalizado. json.Marshal ordena las
+// claves de los mapas, por lo que dos payloads equivalentes producen la misma clave.
+func cacheKey(query string, input domain.PolicyInput) ([sha256.Size]byte, bool) {
+	raw, err := json.Marshal(input)
+	if err != nil {
+		return [sha256.Size]byte{}, false
+	}
+	h := sha256.New()
+	h.Write([]byte(query))
+	h.Write([]byte{0})
+	h.Write(raw)
+
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+	return key, true
+}
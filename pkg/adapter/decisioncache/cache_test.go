@@ -0,0 +1,191 @@
+package decisioncache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/norlis/httpgate/pkg/adapter/decisionlog"
+	"github.com/norlis/httpgate/pkg/domain"
+
+	"github.com/google/uuid"
+)
+
+type countingEnforcer struct {
+	calls    int
+	revision string
+}
+
+func (e *countingEnforcer) IsAllowed(context.Context, domain.PolicyInput) (bool, error) {
+	e.calls++
+	return true, nil
+}
+
+func (e *countingEnforcer) DecideQuery(context.Context, string, domain.PolicyInput) (domain.Decision, error) {
+	e.calls++
+	return domain.Decision{Allow: true}, nil
+}
+
+func (e *countingEnforcer) Revision() string {
+	return e.revision
+}
+
+func input(action string, roles ...string) domain.PolicyInput {
+	return domain.PolicyInput{Action: action, Payload: map[string]any{"roles": roles}}
+}
+
+func TestEnforcer_CachesDecisions(t *testing.T) {
+	next := &countingEnforcer{revision: "r1"}
+	cache := NewEnforcer(next, Config{})
+
+	for range 3 {
+		if allowed, err := cache.IsAllowed(context.Background(), input("GET:/api/test", "admin")); err != nil || !allowed {
+			t.Fatalf("IsAllowed() = %v, %v", allowed, err)
+		}
+	}
+
+	if next.calls != 1 {
+		t.Errorf("calls = %d, want 1", next.calls)
+	}
+	if stats := cache.Stats(); stats.Hits != 2 || stats.Misses != 1 || stats.Size != 1 {
+		t.Errorf("Stats() = %+v, want 2 hits, 1 miss, size 1", stats)
+	}
+}
+
+func TestEnforcer_KeysByQuery(t *testing.T) {
+	next := &countingEnforcer{}
+	cache := NewEnforcer(next, Config{})
+
+	for _, query := range []string{"data.documents.allow", "data.documents.allow", "data.invoices.allow"} {
+		if _, err := cache.DecideQuery(context.Background(), query, input("documents:read")); err != nil {
+			t.Fatalf("DecideQuery() error = %v", err)
+		}
+	}
+
+	if next.calls != 2 {
+		t.Errorf("calls = %d, want 2", next.calls)
+	}
+}
+
+func TestEnforcer_ExpiresEntries(t *testing.T) {
+	next := &countingEnforcer{}
+	cache := NewEnforcer(next, Config{TTL: time.Second})
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	_, _ = cache.IsAllowed(context.Background(), input("GET:/api/test"))
+	now = now.Add(2 * time.Second)
+	_, _ = cache.IsAllowed(context.Background(), input("GET:/api/test"))
+
+	if next.calls != 2 {
+		t.Errorf("calls = %d, want 2", next.calls)
+	}
+}
+
+func TestEnforcer_EvictsLeastRecentlyUsed(t *testing.T) {
+	next := &countingEnforcer{}
+	cache := NewEnforcer(next, Config{MaxEntries: 2})
+
+	_, _ = cache.IsAllowed(context.Background(), input("GET:/a"))
+	_, _ = cache.IsAllowed(context.Background(), input("GET:/b"))
+	_, _ = cache.IsAllowed(context.Background(), input("GET:/a"))
+	_, _ = cache.IsAllowed(context.Background(), input("GET:/c")) // desaloja /b
+	_, _ = cache.IsAllowed(context.Background(), input("GET:/a"))
+
+	if next.calls != 3 {
+		t.Errorf("calls = %d, want 3", next.calls)
+	}
+	if stats := cache.Stats(); stats.Evictions != 1 || stats.Size != 2 {
+		t.Errorf("Stats() = %+v, want 1 eviction, size 2", stats)
+	}
+}
+
+func TestEnforcer_InvalidatesOnReload(t *testing.T) {
+	next := &countingEnforcer{revision: "r1"}
+	cache := NewEnforcer(next, Config{})
+
+	_, _ = cache.IsAllowed(context.Background(), input("GET:/api/test"))
+	next.revision = "r2"
+	_, _ = cache.IsAllowed(context.Background(), input("GET:/api/test"))
+
+	if next.calls != 2 {
+		t.Errorf("calls = %d, want 2", next.calls)
+	}
+}
+
+func TestEnforcer_InvalidatesThroughDecorators(t *testing.T) {
+	next := &countingEnforcer{revision: "r1"}
+	logger, err := decisionlog.New(decisionlog.Config{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := NewEnforcer(decisionlog.NewEnforcer(next, logger), Config{})
+
+	_, _ = cache.IsAllowed(context.Background(), input("GET:/api/test"))
+	next.revision = "r2"
+	_, _ = cache.IsAllowed(context.Background(), input("GET:/api/test"))
+
+	if next.calls != 2 {
+		t.Errorf("calls = %d, want 2", next.calls)
+	}
+	if got := cache.Revision(); got != "r2" {
+		t.Errorf("Revision() = %q, want r2", got)
+	}
+}
+
+func TestEnforcer_HitsGetTimeOrderedIDs(t *testing.T) {
+	cache := NewEnforcer(&countingEnforcer{}, Config{})
+
+	_, _ = cache.Decide(context.Background(), input("GET:/api/test"))
+	decision, err := cache.Decide(context.Background(), input("GET:/api/test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := uuid.Parse(decision.ID)
+	if err != nil {
+		t.Fatalf("ID = %q, %v", decision.ID, err)
+	}
+	if id.Version() != 7 {
+		t.Errorf("ID version = %d, want 7", id.Version())
+	}
+}
+
+type obligingEnforcer struct{}
+
+func (obligingEnforcer) IsAllowed(context.Context, domain.PolicyInput) (bool, error) {
+	return true, nil
+}
+
+func (obligingEnforcer) Decide(context.Context, domain.PolicyInput) (domain.Decision, error) {
+	return domain.Decision{
+		Allow:       true,
+		Reasons:     []string{"admin"},
+		Obligations: domain.Obligations{Headers: map[string]string{"X-Policy": "v1"}},
+	}, nil
+}
+
+func TestEnforcer_HitsDoNotShareDecisions(t *testing.T) {
+	cache := NewEnforcer(obligingEnforcer{}, Config{})
+
+	for range 2 {
+		decision, err := cache.Decide(context.Background(), input("GET:/api/test"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		decision.Reasons[0] = "tampered"
+		decision.Reasons = append(decision.Reasons, "extra")
+		decision.Obligations.Headers["X-Policy"] = "tampered"
+	}
+
+	decision, err := cache.Decide(context.Background(), input("GET:/api/test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decision.Reasons) != 1 || decision.Reasons[0] != "admin" {
+		t.Errorf("Reasons = %v, want [admin]", decision.Reasons)
+	}
+	if got := decision.Obligations.Headers["X-Policy"]; got != "v1" {
+		t.Errorf("Headers[X-Policy] = %q, want v1", got)
+	}
+}
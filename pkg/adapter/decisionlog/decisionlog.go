@@ -0,0 +1,161 @@
+// Package decisionlog registra cada decisión de autorización en uno o varios
+// destinos (zap, archivo rotativo, HTTP), enmascarando antes los campos sensibles.
+package decisionlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/norlis/httpgate/pkg/adapter/apidriven/middleware"
+	"github.com/norlis/httpgate/pkg/domain"
+	"github.com/norlis/httpgate/pkg/port"
+
+	"go.uber.org/zap"
+)
+
+// Event es el registro que se emite por cada evaluación de la política.
+type Event struct {
+	DecisionID string        `json:"decisionId,omitempty"`
+	TraceID    string        `json:"traceId,omitempty"`
+	Timestamp  time.Time     `json:"timestamp"`
+	Query      string        `json:"query,omitempty"` // vacío si se usó la consulta por defecto
+	Action     string        `json:"action"`
+	Allow      bool          `json:"allow"`
+	Reasons    []string      `json:"reasons,omitempty"`
+	Revision   string        `json:"revision,omitempty"`
+	Latency    time.Duration `json:"latency"`
+	Input      any           `json:"input,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// Sink es un destino de eventos. Write no debe bloquear por tiempos largos,
+// ya que se invoca en el camino de la petición.
+type Sink interface {
+	Write(event Event) error
+	Close() error
+}
+
+type Config struct {
+	// Mask contiene JSON pointers (RFC 6901) que se eliminan del evento antes de
+	// escribirlo, por ejemplo "/input/payload/token".
+	Mask []string `yaml:"mask"`
+}
+
+// Logger enmascara los eventos y los reparte entre los destinos configurados.
+type Logger struct {
+	sinks  []Sink
+	masker *masker
+	logger *zap.Logger
+}
+
+func New(cfg Config, logger *zap.Logger, sinks ...Sink) (*Logger, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	m, err := newMasker(cfg.Mask)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Logger{
+		sinks:  sinks,
+		masker: m,
+		logger: logger.Named("decisionlog"),
+	}, nil
+}
+
+// Log enmascara el evento y lo escribe en todos los destinos. Los errores de
+// escritura se registran pero no se propagan: el registro de decisiones no
+// debe afectar a la respuesta.
+func (l *Logger) Log(event Event) {
+	event.Input = l.masker.apply(event.Input)
+
+	for _, sink := range l.sinks {
+		if err := sink.Write(event); err != nil {
+			l.logger.Warn("no se pudo escribir el registro de decisión",
+				zap.String("decisionId", event.DecisionID),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// Close cierra todos los destinos, vaciando los que tengan eventos pendientes.
+func (l *Logger) Close() error {
+	var errs []error
+	for _, sink := range l.sinks {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Enforcer decora un PolicyEnforcer registrando cada decisión que toma.
+type Enforcer struct {
+	next port.PolicyEnforcer
+	log  *Logger
+}
+
+func NewEnforcer(next port.PolicyEnforcer, log *Logger) *Enforcer {
+	return &Enforcer{next: next, log: log}
+}
+
+func (e *Enforcer) Decide(ctx context.Context, input domain.PolicyInput) (domain.Decision, error) {
+	return e.DecideQuery(ctx, "", input)
+}
+
+// DecideQuery registra también las decisiones sobre consultas con nombre.
+func (e *Enforcer) DecideQuery(ctx context.Context, query string, input domain.PolicyInput) (domain.Decision, error) {
+	start := time.Now()
+	decision, err := port.DecideQuery(ctx, e.next, query, input)
+
+	event := Event{
+		DecisionID: decision.ID,
+		TraceID:    middleware.TraceIdFromContext(ctx),
+		Timestamp:  start.UTC(),
+		Query:      query,
+		Action:     input.Action,
+		Allow:      decision.Allow,
+		Reasons:    decision.Reasons,
+		Revision:   decision.Revision,
+		Latency:    time.Since(start),
+		Input:      toDocument(input),
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	e.log.Log(event)
+
+	return decision, err
+}
+
+func (e *Enforcer) IsAllowed(ctx context.Context, input domain.PolicyInput) (bool, error) {
+	decision, err := e.Decide(ctx, input)
+	return decision.Allow, err
+}
+
+// Filter se delega en el enforcer decorado; los filtros no son decisiones y no se registran.
+func (e *Enforcer) Filter(ctx context.Context, query string, input domain.PolicyInput) (domain.Filter, error) {
+	return port.Filter(ctx, e.next, query, input)
+}
+
+// Revision propaga la revisión del enforcer decorado (port.Revisioner).
+func (e *Enforcer) Revision() string {
+	return port.Revision(e.next)
+}
+
+// toDocument convierte el input en un documento JSON genérico para poder
+// enmascararlo sin modificar el valor original.
+func toDocument(v any) any {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil
+	}
+	return doc
+}
@@ -0,0 +1,198 @@
+package decisionlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/norlis/httpgate/pkg/domain"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type memorySink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (s *memorySink) Write(event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *memorySink) Close() error { return nil }
+
+type staticEnforcer struct {
+	decision domain.Decision
+}
+
+func (e staticEnforcer) IsAllowed(context.Context, domain.PolicyInput) (bool, error) {
+	return e.decision.Allow, nil
+}
+
+func (e staticEnforcer) Decide(context.Context, domain.PolicyInput) (domain.Decision, error) {
+	return e.decision, nil
+}
+
+func TestEnforcer_LogsMaskedDecision(t *testing.T) {
+	sink := &memorySink{}
+	logger, err := New(Config{Mask: []string{"/input/payload/token"}}, nil, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enforcer := NewEnforcer(staticEnforcer{decision: domain.Decision{ID: "d1", Allow: true, Revision: "r1"}}, logger)
+
+	input := domain.PolicyInput{
+		Action:  "GET:/api/test",
+		Payload: map[string]any{"token": "secret", "roles": []string{"admin"}},
+	}
+	allowed, err := enforcer.IsAllowed(context.Background(), input)
+	if err != nil || !allowed {
+		t.Fatalf("IsAllowed() = %v, %v, want true, nil", allowed, err)
+	}
+
+	if len(sink.events) != 1 {
+		t.Fatalf("events = %d, want 1", len(sink.events))
+	}
+	event := sink.events[0]
+	if event.DecisionID != "d1" || event.Revision != "r1" || event.Action != "GET:/api/test" || !event.Allow {
+		t.Errorf("event = %+v", event)
+	}
+
+	payload := event.Input.(map[string]any)["payload"].(map[string]any)
+	if _, ok := payload["token"]; ok {
+		t.Error("token was not masked")
+	}
+	if _, ok := payload["roles"]; !ok {
+		t.Error("roles were masked, want only token masked")
+	}
+	if input.Payload["token"] != "secret" {
+		t.Error("masking modified the original input")
+	}
+}
+
+func TestNew_RejectsPointerOutsideInput(t *testing.T) {
+	if _, err := New(Config{Mask: []string{"/payload/token"}}, nil); err == nil {
+		t.Error("New() error = nil, want error")
+	}
+}
+
+func TestZapSink_LogsQuery(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	sink := NewZapSink(zap.New(core))
+
+	if err := sink.Write(Event{Query: "documents", Action: "GET:/api/documents/1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("entries = %d, want 1", len(entries))
+	}
+	if got := entries[0].ContextMap()["query"]; got != "documents" {
+		t.Errorf("query = %v, want documents", got)
+	}
+}
+
+func TestFileSink_Rotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.log")
+	sink, err := NewFileSink(FileConfig{Path: path, MaxSizeBytes: 64, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 5 {
+		if err := sink.Write(Event{Action: "GET:/api/test"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Error("kept more backups than MaxBackups")
+	}
+}
+
+func TestFileSink_RecoversFromFailedRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.log")
+	sink, err := NewFileSink(FileConfig{Path: path, MaxSizeBytes: 64, MaxBackups: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	// Un directorio en path.1 impide el rename de la rotación.
+	if err := os.MkdirAll(filepath.Join(path+".1", "busy"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	event := Event{Action: "GET:/api/test"}
+	_ = sink.Write(event)
+	if err := sink.Write(event); err == nil {
+		t.Error("Write() error = nil, want rotate error")
+	}
+
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(event); err != nil {
+		t.Fatalf("Write() after the rotate failure error = %v", err)
+	}
+
+	raw, err := os.ReadFile(path + ".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(raw, []byte("\n")); lines != 2 {
+		t.Errorf("rotated file has %d events, want 2", lines)
+	}
+}
+
+func TestHttpSink_FlushesBatchOnClose(t *testing.T) {
+	var mu sync.Mutex
+	var received []Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []Event
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		received = append(received, batch...)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	sink, err := NewHttpSink(HttpConfig{URL: srv.URL, BatchSize: 2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if err := sink.Write(Event{DecisionID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = sink.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 3 {
+		t.Errorf("received = %d events, want 3", len(received))
+	}
+}
@@ -0,0 +1,65 @@
+package decisionlog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const inputPointerPrefix = "/input/"
+
+// masker elimina del input los campos indicados por JSON pointers.
+type masker struct {
+	paths [][]string
+}
+
+func newMasker(pointers []string) (*masker, error) {
+	m := &masker{}
+	for _, pointer := range pointers {
+		if !strings.HasPrefix(pointer, inputPointerPrefix) {
+			return nil, fmt.Errorf("el puntero de enmascarado %q debe comenzar con %s", pointer, inputPointerPrefix)
+		}
+		m.paths = append(m.paths, parsePointer(strings.TrimPrefix(pointer, inputPointerPrefix)))
+	}
+	return m, nil
+}
+
+// parsePointer separa los segmentos de un JSON pointer y decodifica ~1 y ~0.
+func parsePointer(pointer string) []string {
+	segments := strings.Split(pointer, "/")
+	for i, s := range segments {
+		segments[i] = strings.ReplaceAll(strings.ReplaceAll(s, "~1", "/"), "~0", "~")
+	}
+	return segments
+}
+
+// apply modifica el documento en el lugar; debe recibir una copia (ver toDocument).
+func (m *masker) apply(doc any) any {
+	for _, path := range m.paths {
+		remove(doc, path)
+	}
+	return doc
+}
+
+func remove(node any, path []string) {
+	last := len(path) == 1
+
+	switch v := node.(type) {
+	case map[string]any:
+		if last {
+			delete(v, path[0])
+			return
+		}
+		remove(v[path[0]], path[1:])
+	case []any:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i >= len(v) {
+			return
+		}
+		if last {
+			v[i] = nil
+			return
+		}
+		remove(v[i], path[1:])
+	}
+}
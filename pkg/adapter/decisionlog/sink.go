@@ -0,0 +1,273 @@
+package decisionlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ZapSink escribe cada evento como una entrada de log.
+type ZapSink struct {
+	logger *zap.Logger
+}
+
+func NewZapSink(logger *zap.Logger) *ZapSink {
+	return &ZapSink{logger: logger.Named("decision")}
+}
+
+func (s *ZapSink) Write(event Event) error {
+	s.logger.Info("decision",
+		zap.String("decisionId", event.DecisionID),
+		zap.String("traceId", event.TraceID),
+		zap.String("query", event.Query),
+		zap.String("action", event.Action),
+		zap.Bool("allow", event.Allow),
+		zap.Strings("reasons", event.Reasons),
+		zap.String("revision", event.Revision),
+		zap.Duration("latency", event.Latency),
+		zap.Any("input", event.Input),
+		zap.String("error", event.Error),
+	)
+	return nil
+}
+
+func (s *ZapSink) Close() error {
+	_ = s.logger.Sync()
+	return nil
+}
+
+// FileConfig configura un archivo JSON Lines que rota al alcanzar MaxSizeBytes.
+type FileConfig struct {
+	Path         string `yaml:"path"`
+	MaxSizeBytes int64  `yaml:"maxSizeBytes"` // por defecto 100 MiB
+	MaxBackups   int    `yaml:"maxBackups"`   // archivos rotados a conservar (path.1 ... path.N), por defecto 5
+}
+
+// FileSink escribe los eventos en un archivo que rota por tamaño.
+type FileSink struct {
+	cfg  FileConfig
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func NewFileSink(cfg FileConfig) (*FileSink, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("la ruta del registro de decisiones no puede estar vacía")
+	}
+	if cfg.MaxSizeBytes <= 0 {
+		cfg.MaxSizeBytes = 100 << 20
+	}
+	if cfg.MaxBackups <= 0 {
+		cfg.MaxBackups = 5
+	}
+
+	s := &FileSink{cfg: cfg}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	s.file, s.size = f, info.Size()
+	return nil
+}
+
+func (s *FileSink) Write(event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Si la rotación falla el evento se escribe igual en el archivo actual y se
+	// vuelve a intentar rotar con el siguiente.
+	var rotateErr error
+	if s.size > 0 && s.size+int64(len(line)) > s.cfg.MaxSizeBytes {
+		rotateErr = s.rotate()
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return errors.Join(rotateErr, err)
+}
+
+// rotate desplaza path.N-1 -> path.N, ..., path -> path.1 y abre un archivo
+// nuevo. El archivo actual se cierra solo cuando el nuevo está abierto, para
+// que un fallo no deje el sink sin archivo.
+func (s *FileSink) rotate() error {
+	for i := s.cfg.MaxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", s.cfg.Path, i), fmt.Sprintf("%s.%d", s.cfg.Path, i+1))
+	}
+	if err := os.Rename(s.cfg.Path, s.cfg.Path+".1"); err != nil {
+		return fmt.Errorf("error al rotar el registro de decisiones: %w", err)
+	}
+
+	previous := s.file
+	if err := s.open(); err != nil {
+		// Se sigue escribiendo en el archivo anterior, ya renombrado.
+		return fmt.Errorf("error al rotar el registro de decisiones: %w", err)
+	}
+	return previous.Close()
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// HttpConfig configura el envío de eventos por lotes a un colector HTTP.
+type HttpConfig struct {
+	URL           string        `yaml:"url"`
+	BatchSize     int           `yaml:"batchSize"`     // por defecto 100
+	FlushInterval time.Duration `yaml:"flushInterval"` // por defecto 5s
+	Timeout       time.Duration `yaml:"timeout"`       // por defecto 10s
+	BufferSize    int           `yaml:"bufferSize"`    // eventos en espera antes de descartar, por defecto 10000
+}
+
+// HttpSink acumula eventos y los envía como un arreglo JSON con POST, cuando
+// se completa un lote o vence FlushInterval. Si el colector no responde y el
+// buffer se llena, los eventos nuevos se descartan en lugar de bloquear.
+type HttpSink struct {
+	cfg    HttpConfig
+	client *http.Client
+	events chan Event
+	done   chan struct{}
+	mu     sync.RWMutex
+	closed bool
+	logger *zap.Logger
+}
+
+func NewHttpSink(cfg HttpConfig, logger *zap.Logger) (*HttpSink, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("la url del colector de decisiones no puede estar vacía")
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 5 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 10000
+	}
+
+	s := &HttpSink{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		events: make(chan Event, cfg.BufferSize),
+		done:   make(chan struct{}),
+		logger: logger.Named("decisionlog.http"),
+	}
+	go s.run()
+
+	return s, nil
+}
+
+func (s *HttpSink) Write(event Event) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return fmt.Errorf("el registro de decisiones está cerrado")
+	}
+
+	select {
+	case s.events <- event:
+		return nil
+	default:
+		return fmt.Errorf("buffer del registro de decisiones lleno, evento descartado")
+	}
+}
+
+func (s *HttpSink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, s.cfg.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.send(batch); err != nil {
+			s.logger.Warn("no se pudo enviar el lote de decisiones", zap.Int("events", len(batch)), zap.Error(err))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case event, ok := <-s.events:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= s.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (s *HttpSink) send(batch []Event) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(s.cfg.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("el colector respondió %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close envía los eventos pendientes y detiene el envío.
+func (s *HttpSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+	s.mu.Unlock()
+
+	<-s.done
+	return nil
+}
@@ -0,0 +1,209 @@
+package opa
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/bundle"
+	"github.com/open-policy-agent/opa/v1/keys"
+)
+
+const (
+	defaultBundlePollInterval = 30 * time.Second
+	defaultBundleMaxSize      = 64 << 20 // 64 MiB
+	defaultBundleKeyID        = "default"
+	defaultBundleAlgorithm    = "RS256"
+	bundleName                = "httpgate"
+)
+
+// errBundleNotModified indica que el servidor de bundles respondió 304 y no hay nada que recargar.
+var errBundleNotModified = errors.New("el bundle no cambió")
+
+// BundleConfig permite cargar las políticas desde un bundle de OPA (tar.gz) en
+// lugar de un directorio. Si se define, PoliciesPath y DataFiles no se usan.
+type BundleConfig struct {
+	Path         string                    `yaml:"path"`         // bundle local, se observa si Watch está activo
+	URL          string                    `yaml:"url"`          // bundle remoto, se consulta cada PollInterval
+	PollInterval time.Duration             `yaml:"pollInterval"` // por defecto 30s
+	MaxSizeBytes int64                     `yaml:"maxSizeBytes"` // tamaño máximo del bundle remoto, por defecto 64 MiB
+	Verification *BundleVerificationConfig `yaml:"verification"` // si se define, el bundle debe estar firmado
+}
+
+// BundleVerificationConfig describe la clave con la que se verifica la firma
+// (.signatures.json) del bundle.
+type BundleVerificationConfig struct {
+	PublicKey string   `yaml:"publicKey"` // clave pública PEM, secreto HMAC o ruta a un archivo que lo contenga
+	KeyID     string   `yaml:"keyId"`     // por defecto "default", igual que opa build --signing-key
+	Algorithm string   `yaml:"algorithm"` // por defecto RS256
+	Scope     string   `yaml:"scope"`
+	Exclude   []string `yaml:"exclude"` // archivos del bundle que no se verifican
+}
+
+// bundleSource lee y verifica el bundle configurado. Recuerda el ETag del
+// último bundle activado para no descargarlo de nuevo si no cambió; un bundle
+// que no llega a activarse (p.ej. porque no compila) se vuelve a descargar.
+type bundleSource struct {
+	cfg          BundleConfig
+	verification *bundle.VerificationConfig
+	httpClient   *http.Client
+	etag         string
+}
+
+func newBundleSource(cfg BundleConfig) (*bundleSource, error) {
+	if (cfg.Path == "") == (cfg.URL == "") {
+		return nil, fmt.Errorf("el bundle de OPA requiere exactamente uno de path o url")
+	}
+
+	if cfg.MaxSizeBytes <= 0 {
+		cfg.MaxSizeBytes = defaultBundleMaxSize
+	}
+	if cfg.Verification != nil {
+		// Los valores por defecto se aplican sobre una copia: la configuración
+		// es del llamador y puede reutilizarse.
+		v := *cfg.Verification
+		cfg.Verification = &v
+	}
+
+	s := &bundleSource{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+
+	if v := cfg.Verification; v != nil {
+		if v.KeyID == "" {
+			v.KeyID = defaultBundleKeyID
+		}
+		if v.Algorithm == "" {
+			v.Algorithm = defaultBundleAlgorithm
+		}
+		if !keys.IsSupportedAlgorithm(v.Algorithm) {
+			return nil, fmt.Errorf("algoritmo de firma no soportado: %s", v.Algorithm)
+		}
+
+		kc, err := keys.NewKeyConfig(v.PublicKey, v.Algorithm, v.Scope)
+		if err != nil {
+			return nil, fmt.Errorf("error al leer la clave de verificación del bundle: %w", err)
+		}
+		s.verification = bundle.NewVerificationConfig(map[string]*bundle.KeyConfig{v.KeyID: kc}, v.KeyID, v.Scope, v.Exclude)
+	}
+
+	return s, nil
+}
+
+// read obtiene el bundle, verifica su firma y las raíces del manifiesto y
+// devuelve sus módulos y datos.
+func (s *bundleSource) read(ctx context.Context) (*loadedPolicies, error) {
+	raw, etag, err := s.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bundle.NewReader(bytes.NewReader(raw)).WithBundleName(bundleName)
+	if s.verification != nil {
+		reader = reader.WithBundleVerificationConfig(s.verification)
+	} else {
+		reader = reader.WithSkipBundleVerification(true)
+	}
+
+	b, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("bundle de OPA inválido: %w", err)
+	}
+	digest := revisionOfBytes(raw)
+	revision := b.Manifest.Revision
+	if revision == "" {
+		revision = digest
+	}
+
+	return &loadedPolicies{
+		modules:   b.ParsedModules(bundleName),
+		documents: b.Data,
+		revision:  revision,
+		digest:    digest,
+		etag:      etag,
+	}, nil
+}
+
+// accept registra el ETag del bundle que se acaba de activar.
+func (s *bundleSource) accept(etag string) {
+	s.etag = etag
+}
+
+func (s *bundleSource) fetch(ctx context.Context) ([]byte, string, error) {
+	if s.cfg.Path != "" {
+		raw, err := os.ReadFile(s.cfg.Path)
+		return raw, "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.cfg.URL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if s.etag != "" {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("error al descargar el bundle de OPA: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, "", errBundleNotModified
+	default:
+		return nil, "", fmt.Errorf("error al descargar el bundle de OPA: estado %d", resp.StatusCode)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, s.cfg.MaxSizeBytes+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("error al descargar el bundle de OPA: %w", err)
+	}
+	if int64(len(raw)) > s.cfg.MaxSizeBytes {
+		return nil, "", fmt.Errorf("el bundle de OPA supera el tamaño máximo de %d bytes", s.cfg.MaxSizeBytes)
+	}
+
+	return raw, resp.Header.Get("ETag"), nil
+}
+
+// poller invoca una función periódicamente: la recarga del bundle remoto o la
+// actualización de un origen de datos.
+type poller struct {
+	done chan struct{}
+	once sync.Once
+}
+
+func newPoller(interval time.Duration, reload func()) *poller {
+	if interval <= 0 {
+		interval = defaultBundlePollInterval
+	}
+
+	p := &poller{done: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				reload()
+			}
+		}
+	}()
+
+	return p
+}
+
+func (p *poller) close() {
+	p.once.Do(func() { close(p.done) })
+}
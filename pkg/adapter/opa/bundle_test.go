@@ -0,0 +1,290 @@
+package opa
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/bundle"
+)
+
+const bundleSecret = "s3cr3t"
+
+func buildBundle(t *testing.T, revision, signingKey string) []byte {
+	t.Helper()
+	return buildBundleWith(t, revision, signingKey, allowPolicy)
+}
+
+func buildBundleWith(t *testing.T, revision, signingKey, policy string) []byte {
+	t.Helper()
+
+	module, err := ast.ParseModule("authz/authz.rego", policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := []string{"authz"}
+	b := bundle.Bundle{
+		Manifest: bundle.Manifest{Revision: revision, Roots: &roots},
+		Data:     map[string]any{},
+		Modules: []bundle.ModuleFile{{
+			URL:    "/authz/authz.rego",
+			Path:   "/authz/authz.rego",
+			Raw:    []byte(policy),
+			Parsed: module,
+		}},
+	}
+
+	if signingKey != "" {
+		if err := b.GenerateSignature(bundle.NewSigningConfig(signingKey, "HS256", ""), defaultBundleKeyID, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := bundle.NewWriter(&buf).Write(b); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// rewriteBundleFile reemplaza el contenido de un archivo del bundle sin tocar
+// la firma, como haría quien modifica un bundle ya firmado.
+func rewriteBundleFile(t *testing.T, raw []byte, name, content string) []byte {
+	t.Helper()
+
+	gz, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	found := false
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Name == name {
+			data, found = []byte(content), true
+			header.Size = int64(len(data))
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !found {
+		t.Fatalf("%s not found in bundle", name)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeBundle(t *testing.T, raw []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSdkClient_SignedBundle(t *testing.T) {
+	verification := &BundleVerificationConfig{PublicKey: bundleSecret, Algorithm: "HS256"}
+
+	// Archivos que se modifican después de firmar el bundle.
+	tamperedModule := map[string]string{"/authz/authz.rego": "package authz\n\nallow := true\n"}
+	tamperedData := map[string]string{"/data.json": `{"authz": {"admins": ["mallory"]}}`}
+
+	tests := []struct {
+		name       string
+		signingKey string
+		tamper     map[string]string
+		wantErr    bool
+	}{
+		{name: "valid signature", signingKey: bundleSecret},
+		{name: "tampered signature", signingKey: "otra-clave", wantErr: true},
+		{name: "unsigned", wantErr: true},
+		{name: "module modified after signing", signingKey: bundleSecret, tamper: tamperedModule, wantErr: true},
+		{name: "data modified after signing", signingKey: bundleSecret, tamper: tamperedData, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := buildBundle(t, "v1", tt.signingKey)
+			for name, content := range tt.tamper {
+				raw = rewriteBundleFile(t, raw, name, content)
+			}
+
+			cfg := Config{
+				Query: "data.authz.allow",
+				Bundle: &BundleConfig{
+					Path:         writeBundle(t, raw),
+					Verification: verification,
+				},
+			}
+
+			client, err := NewOpaSdkClientFromConfig(context.Background(), cfg, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewOpaSdkClientFromConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer client.Close()
+
+			if client.Revision() != "v1" {
+				t.Errorf("Revision() = %s, want v1", client.Revision())
+			}
+			if !isAllowed(t, client) {
+				t.Error("IsAllowed() = false, want true")
+			}
+		})
+	}
+
+	// La configuración compartida entre los casos no recibe los valores por defecto.
+	if verification.KeyID != "" || verification.Algorithm != "HS256" {
+		t.Errorf("verification = %+v, want unchanged", *verification)
+	}
+}
+
+func TestSdkClient_BundleURL(t *testing.T) {
+	raw := buildBundle(t, "v2", "")
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v2"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v2"`)
+		_, _ = w.Write(raw)
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, Config{Query: "data.authz.allow", Bundle: &BundleConfig{URL: srv.URL}})
+	if client.Revision() != "v2" {
+		t.Errorf("Revision() = %s, want v2", client.Revision())
+	}
+
+	if err := client.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if requests != 2 || client.Revision() != "v2" {
+		t.Errorf("requests = %d, revision = %s, want 2, v2", requests, client.Revision())
+	}
+}
+
+func TestSdkClient_ReloadsBundleWithSameRevision(t *testing.T) {
+	path := writeBundle(t, buildBundle(t, "v1", ""))
+	client := newTestClient(t, Config{Query: "data.authz.allow", Bundle: &BundleConfig{Path: path}})
+	if !isAllowed(t, client) {
+		t.Fatal("IsAllowed() = false, want true")
+	}
+
+	// El publicador cambia la política sin cambiar la revisión del manifiesto.
+	if err := os.WriteFile(path, buildBundleWith(t, "v1", "", denyPolicy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if isAllowed(t, client) {
+		t.Error("IsAllowed() = true after reload, want false")
+	}
+	if client.Revision() != "v1" {
+		t.Errorf("Revision() = %s, want v1", client.Revision())
+	}
+}
+
+func TestSdkClient_RetriesBundleThatFailedToCompile(t *testing.T) {
+	good := buildBundle(t, "v1", "")
+	bad := buildBundleWith(t, "v2", "", "package authz\n\nallow if undefined_function(input)\n")
+
+	var (
+		current  atomic.Pointer[[]byte]
+		matchBad atomic.Int32
+	)
+	current.Store(&good)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := *current.Load()
+		etag := `"` + revisionOfBytes(raw) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			if bytes.Equal(raw, bad) {
+				matchBad.Add(1)
+			}
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write(raw)
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, Config{Query: "data.authz.allow", Bundle: &BundleConfig{URL: srv.URL}})
+
+	current.Store(&bad)
+	for range 2 {
+		if err := client.Reload(context.Background()); err == nil {
+			t.Error("Reload() error = nil, want compile error")
+		}
+	}
+	if matchBad.Load() != 0 {
+		t.Error("bundle that failed to compile was marked as downloaded")
+	}
+	if client.Revision() != "v1" {
+		t.Errorf("Revision() = %s, want v1", client.Revision())
+	}
+}
+
+func TestSdkClient_BundleURLMaxSize(t *testing.T) {
+	raw := buildBundle(t, "v1", "")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(raw)
+	}))
+	defer srv.Close()
+
+	_, err := NewOpaSdkClientFromConfig(context.Background(), Config{
+		Query:  "data.authz.allow",
+		Bundle: &BundleConfig{URL: srv.URL, MaxSizeBytes: int64(len(raw)) - 1},
+	}, nil)
+	if err == nil || !strings.Contains(err.Error(), "tamaño máximo") {
+		t.Errorf("NewOpaSdkClientFromConfig() error = %v, want size limit error", err)
+	}
+
+	client := newTestClient(t, Config{
+		Query:  "data.authz.allow",
+		Bundle: &BundleConfig{URL: srv.URL, MaxSizeBytes: int64(len(raw))},
+	})
+	if !isAllowed(t, client) {
+		t.Error("IsAllowed() = false, want true")
+	}
+}
@@ -2,69 +2,503 @@ package opa
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/norlis/httpgate/pkg/domain"
+	"github.com/norlis/httpgate/pkg/kit/fswatch"
+	"github.com/norlis/httpgate/pkg/port"
 
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/metrics"
+	"github.com/open-policy-agent/opa/v1/profiler"
 	"github.com/open-policy-agent/opa/v1/rego"
+	"github.com/open-policy-agent/opa/v1/storage"
+	"github.com/open-policy-agent/opa/v1/storage/inmem"
+	"github.com/open-policy-agent/opa/v1/topdown"
 	"go.uber.org/zap"
 )
 
+// profileTopResults es la cantidad de expresiones que registra Config.Profile.
+const profileTopResults = 10
+
 type Config struct {
 	Query        string   `yaml:"query"`
 	PoliciesPath string   `yaml:"policiesPath"`
 	DataFiles    []string `yaml:"dataFiles"` // opcional, usar si el path es diferente a policiesPath
+	Watch        bool     `yaml:"watch"`     // recarga las políticas y los datos cuando cambian en disco
+
+	Bundle *BundleConfig `yaml:"bundle"` // opcional, reemplaza a PoliciesPath y DataFiles
+
+	// FS, si se define, es el origen de PoliciesPath y DataFiles en lugar del
+	// disco, p.ej. un embed.FS para distribuir las políticas dentro del binario.
+	// Las rutas son relativas a la raíz del FS; PoliciesPath vacío equivale a ".".
+	FS fs.FS `yaml:"-"`
+
+	// Queries son consultas adicionales por nombre, preparadas sobre los mismos
+	// módulos compilados, p.ej. {"reasons": "data.authz.deny_reasons", "tier": "data.ratelimit.tier"}.
+	// Se seleccionan por nombre en DecideQuery, Eval y Filter.
+	Queries map[string]string `yaml:"queries"`
+
+	// DataSources publican documentos obtenidos en tiempo de ejecución (base de
+	// datos, HTTP, callback) sin recompilar las políticas.
+	DataSources []DataSource `yaml:"-"`
+
+	EvalTimeout time.Duration `yaml:"evalTimeout"` // tiempo máximo por evaluación, 0 sin límite
+	Instrument  bool          `yaml:"instrument"`  // registra en debug las métricas de rego de cada evaluación
+	Profile     bool          `yaml:"profile"`     // registra en debug las expresiones más costosas de cada evaluación, solo para diagnóstico
+	Explain     ExplainMode   `yaml:"explain"`     // adjunta la traza a las decisiones que la piden con port.WithExplain, ver ExplainMode
+
+	// Metrics, si se define, publica la latencia de evaluación y compilación en Prometheus.
+	Metrics *Metrics `yaml:"-"`
 }
 
-type SdkClient struct {
+// policyState agrupa todo lo que se obtiene de una carga de políticas.
+// Se reemplaza completo en cada recarga para que las evaluaciones en curso
+// sigan usando una versión consistente.
+type policyState struct {
+	baseRevision  string // revisión de políticas y archivos, sin los orígenes de datos
+	revision      string
+	digest        string // contenido de políticas y archivos, ver loadedPolicies.digest
+	etag          string // ETag del bundle remoto, se confirma al activar el estado
+	compiler      *ast.Compiler
+	store         storage.Store
 	preparedQuery rego.PreparedEvalQuery
-	logger        *zap.Logger
+	queries       sync.Map // consultas adicionales preparadas bajo demanda, ver DecideQuery
+}
+
+type SdkClient struct {
+	cfg    Config
+	state  atomic.Pointer[policyState]
+	logger *zap.Logger
+
+	reloadMu sync.Mutex
+	bundles  *bundleSource
+	watcher  *fswatch.Watcher
+	poller   *poller
+
+	dataMu      sync.Mutex
+	sources     []*dataSourceState
+	dataPollers []*poller
 }
 
 func NewOpaSdkClientFromConfig(ctx context.Context, cfg Config, logger *zap.Logger) (*SdkClient, error) {
-	if cfg.Query == "" || cfg.PoliciesPath == "" {
+	if cfg.FS != nil && cfg.PoliciesPath == "" && cfg.Bundle == nil {
+		cfg.PoliciesPath = "."
+	}
+
+	if cfg.Query == "" || (cfg.PoliciesPath == "" && cfg.Bundle == nil) {
 		return nil, fmt.Errorf("la consulta y la ruta de políticas de OPA no pueden estar vacías")
 	}
 
+	if cfg.Bundle != nil && (cfg.PoliciesPath != "" || len(cfg.DataFiles) > 0) {
+		return nil, fmt.Errorf("el bundle de OPA no se puede combinar con policiesPath ni dataFiles")
+	}
+
+	if cfg.FS != nil && cfg.Watch {
+		return nil, fmt.Errorf("watch no está disponible para políticas cargadas desde un fs.FS")
+	}
+
+	for name, query := range cfg.Queries {
+		if name == "" || query == "" {
+			return nil, fmt.Errorf("las consultas con nombre de OPA no pueden tener nombre ni consulta vacíos")
+		}
+	}
+
+	if err := cfg.Explain.validate(); err != nil {
+		return nil, err
+	}
+
 	if logger == nil {
 		logger = zap.NewNop()
 	}
 
 	logger = logger.Named("OPA").With(zap.String("query", cfg.Query))
 
-	r, err := rego.New(
-		rego.Query(cfg.Query),
-		rego.Load(append([]string{cfg.PoliciesPath}, cfg.DataFiles...), nil),
-	).PrepareForEval(ctx)
+	c := &SdkClient{
+		cfg:    cfg,
+		logger: logger,
+	}
 
+	if cfg.Bundle != nil {
+		bundles, err := newBundleSource(*cfg.Bundle)
+		if err != nil {
+			return nil, err
+		}
+		c.bundles = bundles
+	}
+
+	sources, err := newDataSources(cfg.DataSources)
+	if err != nil {
+		return nil, err
+	}
+	c.sources = sources
+	for _, ds := range c.sources {
+		if _, err := c.fetchData(ctx, ds); err != nil {
+			return nil, err
+		}
+	}
+
+	state, err := c.load(ctx)
 	if err != nil {
 		logger.Error("Error al preparar la consulta de OPA", zap.Error(err))
+		return nil, err
+	}
+	c.state.Store(state)
+	c.acceptBundle(state)
+	logger.Info("políticas de OPA cargadas", zap.String("revision", state.revision))
+
+	if cfg.Watch && len(policyPaths(cfg)) > 0 {
+		w, err := fswatch.New(policyPaths(cfg), c.logger, func() {
+			_ = c.Reload(context.Background())
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error al observar las políticas de OPA: %w", err)
+		}
+		c.watcher = w
+	}
+
+	if cfg.Bundle != nil && cfg.Bundle.URL != "" {
+		c.poller = newPoller(cfg.Bundle.PollInterval, func() {
+			c.logger.Debug("consultando bundle de OPA")
+			_ = c.Reload(context.Background())
+		})
+	}
+
+	for _, ds := range c.sources {
+		if ds.src.Interval > 0 {
+			c.dataPollers = append(c.dataPollers, newPoller(ds.src.Interval, func() { c.refreshSource(ds) }))
+		}
+	}
+
+	return c, nil
+}
+
+// load lee las políticas y los datos, compila los módulos y prepara la consulta.
+// No modifica el estado activo del cliente.
+func (c *SdkClient) load(ctx context.Context) (*policyState, error) {
+	loaded, err := c.loadPolicies(ctx)
+	if err != nil {
+		if errors.Is(err, errBundleNotModified) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error al cargar las políticas de OPA: %w", err)
+	}
+
+	start := time.Now()
+	compiler := ast.NewCompiler()
+	compiler.Compile(loaded.modules)
+	if compiler.Failed() {
+		return nil, fmt.Errorf("error al compilar las políticas de OPA: %w", compiler.Errors)
+	}
+
+	store := inmem.NewFromObject(loaded.documents)
+	if err := c.writeData(ctx, store); err != nil {
+		return nil, err
+	}
+
+	prepared, err := rego.New(
+		rego.Query(c.cfg.Query),
+		rego.Compiler(compiler),
+		rego.Store(store),
+	).PrepareForEval(ctx)
+	if err != nil {
 		return nil, fmt.Errorf("error al preparar la consulta de OPA: %w", err)
 	}
 
-	return &SdkClient{
-		preparedQuery: r,
-		logger:        logger,
-	}, nil
+	state := &policyState{
+		baseRevision:  loaded.revision,
+		revision:      c.revisionWithData(loaded.revision),
+		digest:        loaded.digest,
+		etag:          loaded.etag,
+		compiler:      compiler,
+		store:         store,
+		preparedQuery: prepared,
+	}
 
+	// Las consultas con nombre se preparan al cargar para que un error en
+	// cualquiera de ellas impida usar la revisión.
+	for _, query := range c.cfg.Queries {
+		if _, err := state.prepare(ctx, query); err != nil {
+			return nil, err
+		}
+	}
+
+	elapsed := time.Since(start)
+	c.cfg.Metrics.observeCompile(elapsed)
+	c.logger.Debug("políticas de OPA compiladas",
+		zap.String("revision", state.revision),
+		zap.Duration("duration", elapsed),
+	)
+
+	return state, nil
 }
 
-// IsAllowed evalúa la política cargada con el input proporcionado.
-func (c *SdkClient) IsAllowed(ctx context.Context, input domain.PolicyInput) (bool, error) {
-	results, err := c.preparedQuery.Eval(ctx, rego.EvalInput(input))
+// Reload vuelve a cargar las políticas y los datos y reemplaza la consulta activa
+// de forma atómica. Si la nueva versión no compila se conserva la última válida
+// y se devuelve el error.
+func (c *SdkClient) Reload(ctx context.Context) error {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	state, err := c.load(ctx)
+	if errors.Is(err, errBundleNotModified) {
+		return nil
+	}
+	if err != nil {
+		c.logger.Error("recarga de políticas descartada, se mantiene la revisión activa",
+			zap.String("revision", c.Revision()),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	// La revisión cubre los orígenes de datos y el digest el contenido de las
+	// políticas: solo si ninguno cambió no hay nada que activar.
+	previous := c.state.Load()
+	if previous != nil && previous.revision == state.revision && previous.digest == state.digest {
+		c.acceptBundle(state)
+		return nil
+	}
+
+	c.state.Store(state)
+	c.acceptBundle(state)
+	c.logger.Info("políticas de OPA recargadas", zap.String("revision", state.revision))
+	return nil
+}
+
+// acceptBundle confirma el ETag del bundle una vez activado su estado, para
+// que un bundle que no compila no quede marcado como descargado.
+func (c *SdkClient) acceptBundle(state *policyState) {
+	if c.bundles != nil {
+		c.bundles.accept(state.etag)
+	}
+}
+
+// Revision identifica la versión de políticas y datos que está evaluando el cliente.
+func (c *SdkClient) Revision() string {
+	if state := c.state.Load(); state != nil {
+		return state.revision
+	}
+	return ""
+}
+
+// Close detiene la observación de archivos y las consultas periódicas del bundle
+// remoto y de los orígenes de datos, si estaban activas.
+func (c *SdkClient) Close() error {
+	if c.poller != nil {
+		c.poller.close()
+	}
+	for _, p := range c.dataPollers {
+		p.close()
+	}
+	if c.watcher == nil {
+		return nil
+	}
+	return c.watcher.Close()
+}
+
+// Decide evalúa la política cargada con el input proporcionado y devuelve la
+// decisión completa, identificada y asociada a la revisión activa.
+func (c *SdkClient) Decide(ctx context.Context, input domain.PolicyInput) (domain.Decision, error) {
+	state := c.state.Load()
+	return c.evaluate(ctx, state, c.cfg.Query, state.preparedQuery, input)
+}
+
+// DecideQuery evalúa otra consulta sobre las mismas políticas y datos. query
+// puede ser el nombre de una consulta de Config.Queries o una consulta de rego,
+// p.ej. "data.documents.allow", que se prepara la primera vez que se usa con
+// cada revisión.
+func (c *SdkClient) DecideQuery(ctx context.Context, query string, input domain.PolicyInput) (domain.Decision, error) {
+	resolved := c.resolve(query)
+	if resolved == "" || resolved == c.cfg.Query {
+		return c.Decide(ctx, input)
+	}
+
+	state := c.state.Load()
+	prepared, err := state.prepare(ctx, resolved)
+	if err != nil {
+		return domain.Decision{}, err
+	}
+	return c.evaluate(ctx, state, query, prepared, input)
+}
+
+// Eval evalúa una consulta que no es una decisión (p.ej. "tier" ->
+// data.ratelimit.tier) y devuelve su valor, o nil si no está definido.
+func (c *SdkClient) Eval(ctx context.Context, query string, input domain.PolicyInput) (any, error) {
+	state := c.state.Load()
+	prepared, err := state.prepare(ctx, c.resolve(query))
 	if err != nil {
-		return false, fmt.Errorf("error al evaluar la política de OPA: %w", err)
+		return nil, err
 	}
 
-	if len(results) == 0 {
-		return false, nil
+	start := time.Now()
+	result, err := c.eval(ctx, query, prepared, input)
+	switch {
+	case err != nil:
+		c.cfg.Metrics.observeDecision(c.queryLabel(query), domain.Decision{}, err, time.Since(start))
+		return nil, fmt.Errorf("error al evaluar la consulta de OPA %q: %w", query, err)
+	case result.defined:
+		c.cfg.Metrics.observeEval(c.queryLabel(query), resultDefined, time.Since(start))
+	default:
+		c.cfg.Metrics.observeEval(c.queryLabel(query), resultUndefined, time.Since(start))
 	}
+	return result.value, nil
+}
+
+func (c *SdkClient) queryLabel(query string) string {
+	return queryLabel(c.cfg.Query, c.cfg.Queries, query)
+}
 
-	allowed, ok := results[0].Expressions[0].Value.(bool)
-	if !ok {
-		//c.logger.Warn("not pass authz", zap.Bool("allowed", allowed), zap.Any("input", input))
-		return false, fmt.Errorf("la política de OPA no devolvió un resultado booleano")
+// resolve traduce el nombre de una consulta de Config.Queries a su consulta de rego.
+func (c *SdkClient) resolve(query string) string {
+	if resolved, ok := c.cfg.Queries[query]; ok {
+		return resolved
 	}
+	return query
+}
 
-	return allowed, nil
+func (s *policyState) prepare(ctx context.Context, query string) (rego.PreparedEvalQuery, error) {
+	if prepared, ok := s.queries.Load(query); ok {
+		return prepared.(rego.PreparedEvalQuery), nil
+	}
+
+	prepared, err := rego.New(
+		rego.Query(query),
+		rego.Compiler(s.compiler),
+		rego.Store(s.store),
+	).PrepareForEval(ctx)
+	if err != nil {
+		return rego.PreparedEvalQuery{}, fmt.Errorf("error al preparar la consulta de OPA %q: %w", query, err)
+	}
+
+	s.queries.Store(query, prepared)
+	return prepared, nil
+}
+
+func (c *SdkClient) evaluate(ctx context.Context, state *policyState, query string, prepared rego.PreparedEvalQuery, input domain.PolicyInput) (decision domain.Decision, err error) {
+	start := time.Now()
+	defer func() {
+		c.cfg.Metrics.observeDecision(c.queryLabel(query), decision, err, time.Since(start))
+	}()
+
+	result, err := c.eval(ctx, query, prepared, input)
+	if err != nil {
+		return domain.Decision{}, fmt.Errorf("error al evaluar la política de OPA: %w", err)
+	}
+
+	decision, err = decisionFromResult(result.value)
+	if err != nil {
+		return domain.Decision{}, err
+	}
+	decision.ID = domain.NewDecisionID()
+	decision.Revision = state.revision
+
+	if result.trace != nil {
+		decision.Explanation = &domain.Explanation{Trace: result.trace, Input: input}
+		c.logger.Debug("explicación de la decisión",
+			zap.String("decisionId", decision.ID),
+			zap.String("evalQuery", query),
+			zap.Bool("allowed", decision.Allow),
+			zap.Any("input", input),
+			zap.Strings("trace", result.trace),
+		)
+	}
+
+	c.logger.Debug("política evaluada",
+		zap.String("decisionId", decision.ID),
+		zap.String("evalQuery", query),
+		zap.String("action", input.Action),
+		zap.Bool("allowed", decision.Allow),
+		zap.String("revision", decision.Revision),
+	)
+
+	return decision, nil
+}
+
+// evalResult es el valor de la primera expresión de la consulta, si la
+// consulta produjo algún resultado y, en modo explicación, la traza.
+type evalResult struct {
+	value   any
+	defined bool
+	trace   []string
+}
+
+// eval ejecuta la consulta preparada con el límite de Config.EvalTimeout y,
+// si están activos, la instrumentación, el perfilado y la explicación.
+func (c *SdkClient) eval(ctx context.Context, query string, prepared rego.PreparedEvalQuery, input domain.PolicyInput) (evalResult, error) {
+	evalCtx, cancel := c.evalContext(ctx)
+	defer cancel()
+
+	opts := []rego.EvalOption{rego.EvalInput(input)}
+
+	var m metrics.Metrics
+	if c.cfg.Instrument {
+		m = metrics.New()
+		opts = append(opts, rego.EvalMetrics(m), rego.EvalInstrument(true))
+	}
+
+	var p *profiler.Profiler
+	if c.cfg.Profile {
+		p = profiler.New()
+		opts = append(opts, rego.EvalQueryTracer(p))
+	}
+
+	var tracer *topdown.BufferTracer
+	if c.cfg.Explain != ExplainOff && port.ExplainRequested(ctx) {
+		// Sin indexación ni salida anticipada se evalúan todas las reglas, así
+		// la traza muestra también las que fallaron.
+		tracer = topdown.NewBufferTracer()
+		opts = append(opts, rego.EvalQueryTracer(tracer), rego.EvalRuleIndexing(false), rego.EvalEarlyExit(false))
+	}
+
+	results, err := prepared.Eval(evalCtx, opts...)
+
+	if m != nil {
+		c.logger.Debug("métricas de la evaluación de OPA",
+			zap.String("evalQuery", query),
+			zap.Any("metrics", m.All()),
+		)
+	}
+	if p != nil {
+		c.logger.Debug("perfil de la evaluación de OPA",
+			zap.String("evalQuery", query),
+			zap.Any("profile", p.ReportTopNResults(profileTopResults, []string{"total_time_ns"})),
+		)
+	}
+
+	if err != nil {
+		if ctx.Err() == nil && errors.Is(evalCtx.Err(), context.DeadlineExceeded) {
+			return evalResult{}, fmt.Errorf("%w (%s)", ErrEvalTimeout, c.cfg.EvalTimeout)
+		}
+		return evalResult{}, err
+	}
+
+	var result evalResult
+	if tracer != nil {
+		result.trace = c.cfg.Explain.render(*tracer)
+	}
+	if len(results) > 0 {
+		result.value, result.defined = results[0].Expressions[0].Value, true
+	}
+	return result, nil
+}
+
+// evalContext aplica Config.EvalTimeout al contexto de la petición.
+func (c *SdkClient) evalContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.cfg.EvalTimeout > 0 {
+		return context.WithTimeout(ctx, c.cfg.EvalTimeout)
+	}
+	return ctx, func() {}
+}
+
+// IsAllowed evalúa la política cargada con el input proporcionado.
+// Se mantiene por compatibilidad, usar Decide para obtener el detalle.
+func (c *SdkClient) IsAllowed(ctx context.Context, input domain.PolicyInput) (bool, error) {
+	decision, err := c.Decide(ctx, input)
+	return decision.Allow, err
 }
@@ -0,0 +1,297 @@
+package opa
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/norlis/httpgate/pkg/domain"
+	"github.com/norlis/httpgate/pkg/port"
+	"github.com/norlis/httpgate/policies"
+)
+
+const allowPolicy = `package authz
+
+default allow := false
+
+allow if input.action == "GET:/api/test"
+`
+
+const denyPolicy = `package authz
+
+default allow := false
+`
+
+func writePolicy(t *testing.T, dir, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, "authz.rego"), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestClient(t *testing.T, cfg Config) *SdkClient {
+	t.Helper()
+	client, err := NewOpaSdkClientFromConfig(context.Background(), cfg, nil)
+	if err != nil {
+		t.Fatalf("NewOpaSdkClientFromConfig() error = %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func isAllowed(t *testing.T, client *SdkClient) bool {
+	t.Helper()
+	allowed, err := client.IsAllowed(context.Background(), domain.PolicyInput{Action: "GET:/api/test"})
+	if err != nil {
+		t.Fatalf("IsAllowed() error = %v", err)
+	}
+	return allowed
+}
+
+func TestSdkClient_ReloadKeepsLastGoodPolicy(t *testing.T) {
+	dir := t.TempDir()
+	writePolicy(t, dir, allowPolicy)
+
+	client := newTestClient(t, Config{Query: "data.authz.allow", PoliciesPath: dir})
+	revision := client.Revision()
+
+	if !isAllowed(t, client) {
+		t.Fatal("IsAllowed() = false, want true")
+	}
+
+	writePolicy(t, dir, "package authz\n\nallow if {")
+	if err := client.Reload(context.Background()); err == nil {
+		t.Fatal("Reload() error = nil, want compile error")
+	}
+	if client.Revision() != revision {
+		t.Errorf("Revision() = %s, want %s", client.Revision(), revision)
+	}
+	if !isAllowed(t, client) {
+		t.Error("IsAllowed() = false after failed reload, want true")
+	}
+
+	writePolicy(t, dir, denyPolicy)
+	if err := client.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if client.Revision() == revision {
+		t.Error("Revision() did not change after reload")
+	}
+	if isAllowed(t, client) {
+		t.Error("IsAllowed() = true after reload, want false")
+	}
+}
+
+func TestSdkClient_Watch(t *testing.T) {
+	dir := t.TempDir()
+	writePolicy(t, dir, allowPolicy)
+
+	client := newTestClient(t, Config{Query: "data.authz.allow", PoliciesPath: dir, Watch: true})
+	revision := client.Revision()
+
+	writePolicy(t, dir, denyPolicy)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for client.Revision() == revision {
+		if time.Now().After(deadline) {
+			t.Fatal("policy was not reloaded after change")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if isAllowed(t, client) {
+		t.Error("IsAllowed() = true after watched change, want false")
+	}
+}
+
+func TestSdkClient_Decide(t *testing.T) {
+	dir := t.TempDir()
+	writePolicy(t, dir, `package authz
+
+decision := {
+	"allow": false,
+	"reasons": ["tenant mismatch"],
+	"obligations": {"headers": {"X-Policy": "tenant"}},
+}
+`)
+
+	client := newTestClient(t, Config{Query: "data.authz.decision", PoliciesPath: dir})
+
+	decision, err := client.Decide(context.Background(), domain.PolicyInput{Action: "GET:/api/test"})
+	if err != nil {
+		t.Fatalf("Decide() error = %v", err)
+	}
+	if decision.Allow {
+		t.Error("Allow = true, want false")
+	}
+	if len(decision.Reasons) != 1 || decision.Reasons[0] != "tenant mismatch" {
+		t.Errorf("Reasons = %v, want [tenant mismatch]", decision.Reasons)
+	}
+	if decision.Obligations.Headers["X-Policy"] != "tenant" {
+		t.Errorf("Obligations.Headers = %v, want X-Policy: tenant", decision.Obligations.Headers)
+	}
+	if decision.ID == "" || decision.Revision != client.Revision() {
+		t.Errorf("ID = %q, Revision = %q, want non-empty ID and revision %q", decision.ID, decision.Revision, client.Revision())
+	}
+}
+
+func TestSdkClient_DecideQuery(t *testing.T) {
+	dir := t.TempDir()
+	writePolicy(t, dir, allowPolicy+`
+documents_allow if input.resource.owner == input.payload.sub
+`)
+
+	client := newTestClient(t, Config{Query: "data.authz.allow", PoliciesPath: dir})
+
+	input := domain.PolicyInput{
+		Payload:  map[string]any{"sub": "user-1"},
+		Action:   "documents:read",
+		Resource: map[string]any{"owner": "user-1"},
+	}
+	for range 2 {
+		decision, err := client.DecideQuery(context.Background(), "data.authz.documents_allow", input)
+		if err != nil {
+			t.Fatalf("DecideQuery() error = %v", err)
+		}
+		if !decision.Allow || decision.Revision != client.Revision() {
+			t.Errorf("decision = %+v, want allow with revision %q", decision, client.Revision())
+		}
+	}
+
+	input.Resource = map[string]any{"owner": "user-2"}
+	if decision, err := client.DecideQuery(context.Background(), "data.authz.documents_allow", input); err != nil || decision.Allow {
+		t.Errorf("DecideQuery() other owner = %+v, %v, want deny", decision, err)
+	}
+
+	if _, err := client.DecideQuery(context.Background(), "data.authz[", input); err == nil {
+		t.Error("DecideQuery() invalid query error = nil, want error")
+	}
+}
+
+func TestSdkClient_NamedQueries(t *testing.T) {
+	dir := t.TempDir()
+	writePolicy(t, dir, allowPolicy+`
+admin if "admin" in input.payload.roles
+
+tier := "gold" if admin
+else := "bronze"
+`)
+
+	client := newTestClient(t, Config{
+		Query:        "data.authz.allow",
+		PoliciesPath: dir,
+		Queries:      map[string]string{"admin": "data.authz.admin", "tier": "data.authz.tier"},
+	})
+
+	input := domain.PolicyInput{Payload: map[string]any{"roles": []string{"admin"}}, Action: "GET:/api/other"}
+
+	if decision, err := client.DecideQuery(context.Background(), "admin", input); err != nil || !decision.Allow {
+		t.Errorf("DecideQuery(admin) = %+v, %v, want allow", decision, err)
+	}
+	if decision, err := client.DecideQuery(context.Background(), "", input); err != nil || decision.Allow {
+		t.Errorf("DecideQuery(default) = %+v, %v, want deny", decision, err)
+	}
+	if tier, err := client.Eval(context.Background(), "tier", input); err != nil || tier != "gold" {
+		t.Errorf("Eval(tier) = %v, %v, want gold", tier, err)
+	}
+
+	_, err := NewOpaSdkClientFromConfig(context.Background(), Config{
+		Query:        "data.authz.allow",
+		PoliciesPath: dir,
+		Queries:      map[string]string{"broken": "data.authz["},
+	}, nil)
+	if err == nil {
+		t.Error("NewOpaSdkClientFromConfig() with invalid named query error = nil, want error")
+	}
+}
+
+func TestSdkClient_LoadsFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"authz/authz.rego": {Data: []byte(`package authz
+
+default allow := false
+
+allow if input.action in data.allowed
+`)},
+		"authz/data.json": {Data: []byte(`{"allowed": ["GET:/api/test"]}`)},
+		"extra/data.json": {Data: []byte(`{"allowed": ["GET:/api/extra"]}`)},
+	}
+
+	client := newTestClient(t, Config{Query: "data.authz.allow", FS: fsys, PoliciesPath: "authz"})
+	if !isAllowed(t, client) {
+		t.Error("IsAllowed() = false, want true")
+	}
+
+	// Igual que con el disco, DataFiles se carga junto a PoliciesPath y un
+	// documento en conflicto es un error.
+	_, err := NewOpaSdkClientFromConfig(context.Background(), Config{
+		Query:        "data.authz.allow",
+		FS:           fsys,
+		PoliciesPath: "authz",
+		DataFiles:    []string{"extra/data.json"},
+	}, nil)
+	if err == nil {
+		t.Error("NewOpaSdkClientFromConfig() with conflicting data error = nil, want error")
+	}
+
+	if _, err := NewOpaSdkClientFromConfig(context.Background(), Config{Query: "data.authz.allow", FS: fsys, Watch: true}, nil); err == nil {
+		t.Error("NewOpaSdkClientFromConfig() with FS and Watch error = nil, want error")
+	}
+}
+
+func TestSdkClient_LoadsEmbeddedPolicies(t *testing.T) {
+	client := newTestClient(t, Config{Query: "data.authz.decision", FS: policies.Authz, PoliciesPath: "authz"})
+
+	decision, err := client.Decide(context.Background(), domain.PolicyInput{Action: "GET:/health"})
+	if err != nil {
+		t.Fatalf("Decide() error = %v", err)
+	}
+	if !decision.Allow {
+		t.Errorf("Decide(GET:/health) = %+v, want allow by whitelist", decision)
+	}
+}
+
+func TestSdkClient_Explain(t *testing.T) {
+	dir := t.TempDir()
+	writePolicy(t, dir, allowPolicy)
+	input := domain.PolicyInput{Action: "DELETE:/api/test"}
+
+	client := newTestClient(t, Config{Query: "data.authz.allow", PoliciesPath: dir, Explain: ExplainFails})
+
+	decision, err := client.Decide(context.Background(), input)
+	if err != nil {
+		t.Fatalf("Decide() error = %v", err)
+	}
+	if decision.Explanation != nil {
+		t.Error("Explanation != nil without port.WithExplain")
+	}
+
+	decision, err = client.Decide(port.WithExplain(context.Background()), input)
+	if err != nil {
+		t.Fatalf("Decide() error = %v", err)
+	}
+	if decision.Explanation == nil {
+		t.Fatal("Explanation = nil, want trace")
+	}
+	if decision.Explanation.Input.Action != input.Action {
+		t.Errorf("Explanation.Input.Action = %q, want %q", decision.Explanation.Input.Action, input.Action)
+	}
+	if trace := strings.Join(decision.Explanation.Trace, "\n"); !strings.Contains(trace, `input.action = "GET:/api/test"`) {
+		t.Errorf("Explanation.Trace = %s, want the failed expression", trace)
+	}
+
+	// Sin el modo habilitado en la configuración la cabecera no tiene efecto.
+	disabled := newTestClient(t, Config{Query: "data.authz.allow", PoliciesPath: dir})
+	decision, _ = disabled.Decide(port.WithExplain(context.Background()), input)
+	if decision.Explanation != nil {
+		t.Error("Explanation != nil with Explain disabled")
+	}
+
+	if _, err := NewOpaSdkClientFromConfig(context.Background(), Config{Query: "data.authz.allow", PoliciesPath: dir, Explain: "verbose"}, nil); err == nil {
+		t.Error("NewOpaSdkClientFromConfig() error = nil, want invalid explain mode")
+	}
+}
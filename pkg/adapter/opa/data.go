@@ -0,0 +1,356 @@
+package opa
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/norlis/httpgate/pkg/port"
+
+	"github.com/open-policy-agent/opa/v1/storage"
+	"go.uber.org/zap"
+)
+
+// DataProvider obtiene un documento de datos para la política (p.ej. la
+// relación entre roles y permisos guardada en una base de datos).
+type DataProvider interface {
+	Fetch(ctx context.Context) (any, error)
+}
+
+// DataProviderFunc adapta una función a DataProvider.
+type DataProviderFunc func(ctx context.Context) (any, error)
+
+func (f DataProviderFunc) Fetch(ctx context.Context) (any, error) {
+	return f(ctx)
+}
+
+// DataSource publica el documento de Provider en data.<Path> sin recompilar
+// las políticas. Si coincide con un documento de DataFiles, lo reemplaza.
+type DataSource struct {
+	Path     string // destino con "/" o ".", p.ej. "roles" -> data.roles
+	Provider DataProvider
+	Interval time.Duration // cada cuánto se actualiza; 0 solo con RefreshData
+	MaxAge   time.Duration // antigüedad a partir de la cual DataChecker falla, por defecto 3*Interval
+}
+
+// DataSourceStatus describe el estado de actualización de un DataSource.
+type DataSourceStatus struct {
+	Path        string        `json:"path"`
+	LastSuccess time.Time     `json:"lastSuccess"`
+	LastAttempt time.Time     `json:"lastAttempt"`
+	LastError   string        `json:"lastError,omitempty"`
+	Failures    uint64        `json:"failures"` // fallos consecutivos desde la última actualización correcta
+	Staleness   time.Duration `json:"staleness"`
+}
+
+type dataSourceState struct {
+	src  DataSource
+	path storage.Path
+
+	// protegidos por SdkClient.dataMu
+	value       any
+	raw         []byte
+	lastSuccess time.Time
+	lastAttempt time.Time
+	lastErr     error
+	failures    uint64
+}
+
+func newDataSources(sources []DataSource) ([]*dataSourceState, error) {
+	states := make([]*dataSourceState, 0, len(sources))
+	for _, src := range sources {
+		if src.Provider == nil {
+			return nil, fmt.Errorf("el origen de datos %q no tiene provider", src.Path)
+		}
+		p := strings.Trim(strings.ReplaceAll(src.Path, ".", "/"), "/")
+		if p == "" {
+			return nil, fmt.Errorf("el origen de datos requiere un path")
+		}
+		path, ok := storage.ParsePath("/" + p)
+		if !ok {
+			return nil, fmt.Errorf("path de datos inválido: %q", src.Path)
+		}
+		if src.MaxAge <= 0 {
+			src.MaxAge = 3 * src.Interval
+		}
+		states = append(states, &dataSourceState{src: src, path: path})
+	}
+	return states, nil
+}
+
+// fetchData consulta un origen. Si falla se conserva el último documento válido.
+// Devuelve true si el documento cambió.
+func (c *SdkClient) fetchData(ctx context.Context, ds *dataSourceState) (bool, error) {
+	value, err := ds.src.Provider.Fetch(ctx)
+
+	var raw []byte
+	if err == nil {
+		// Se normaliza a tipos JSON, que es lo que admite el store de OPA.
+		raw, err = json.Marshal(value)
+		if err == nil {
+			value = nil
+			err = json.Unmarshal(raw, &value)
+		}
+	}
+
+	c.dataMu.Lock()
+	defer c.dataMu.Unlock()
+
+	ds.lastAttempt = time.Now()
+	if err != nil {
+		ds.lastErr = err
+		ds.failures++
+		return false, fmt.Errorf("error al obtener los datos de %s: %w", ds.src.Path, err)
+	}
+
+	changed := !bytes.Equal(raw, ds.raw)
+	ds.value, ds.raw = value, raw
+	ds.lastSuccess, ds.lastErr, ds.failures = ds.lastAttempt, nil, 0
+	c.cfg.Metrics.observeDataSuccess(ds.src.Path, ds.lastSuccess)
+	return changed, nil
+}
+
+// RefreshData consulta todos los orígenes de datos y publica los documentos
+// que cambiaron. Los orígenes que fallan conservan su último documento válido.
+func (c *SdkClient) RefreshData(ctx context.Context) error {
+	var errs []error
+	changed := false
+	for _, ds := range c.sources {
+		ok, err := c.fetchData(ctx, ds)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		changed = changed || ok
+	}
+
+	if changed {
+		if err := c.publishData(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *SdkClient) refreshSource(ds *dataSourceState) {
+	ctx := context.Background()
+	changed, err := c.fetchData(ctx, ds)
+	if err != nil {
+		c.logger.Warn("no se pudieron actualizar los datos, se mantienen los anteriores",
+			zap.String("path", ds.src.Path),
+			zap.Error(err),
+		)
+		return
+	}
+	if changed {
+		if err := c.publishData(ctx); err != nil {
+			c.logger.Error("error al publicar los datos en OPA", zap.Error(err))
+		}
+	}
+}
+
+// publishData escribe los documentos en el store activo y publica una revisión
+// nueva con el mismo compilador y las mismas consultas preparadas.
+func (c *SdkClient) publishData(ctx context.Context) error {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	current := c.state.Load()
+	if err := c.writeData(ctx, current.store); err != nil {
+		return err
+	}
+
+	next := &policyState{
+		baseRevision:  current.baseRevision,
+		revision:      c.revisionWithData(current.baseRevision),
+		digest:        current.digest,
+		compiler:      current.compiler,
+		store:         current.store,
+		preparedQuery: current.preparedQuery,
+	}
+	c.state.Store(next)
+	c.logger.Info("datos de OPA actualizados", zap.String("revision", next.revision))
+	return nil
+}
+
+// writeData escribe los documentos de los orígenes de datos en el store.
+func (c *SdkClient) writeData(ctx context.Context, store storage.Store) error {
+	c.dataMu.Lock()
+	defer c.dataMu.Unlock()
+
+	if len(c.sources) == 0 {
+		return nil
+	}
+
+	txn, err := store.NewTransaction(ctx, storage.WriteParams)
+	if err != nil {
+		return err
+	}
+	for _, ds := range c.sources {
+		if ds.raw == nil {
+			continue
+		}
+		if err := storage.MakeDir(ctx, store, txn, ds.path[:len(ds.path)-1]); err != nil {
+			store.Abort(ctx, txn)
+			return fmt.Errorf("error al crear %s en el store de OPA: %w", ds.src.Path, err)
+		}
+		if err := store.Write(ctx, txn, storage.AddOp, ds.path, ds.value); err != nil {
+			store.Abort(ctx, txn)
+			return fmt.Errorf("error al escribir %s en el store de OPA: %w", ds.src.Path, err)
+		}
+	}
+	return store.Commit(ctx, txn)
+}
+
+// revisionWithData combina la revisión de las políticas con el contenido de
+// los orígenes de datos, para que la revisión cambie cuando cambian los datos.
+func (c *SdkClient) revisionWithData(base string) string {
+	c.dataMu.Lock()
+	defer c.dataMu.Unlock()
+
+	if len(c.sources) == 0 {
+		return base
+	}
+
+	sources := make([]*dataSourceState, len(c.sources))
+	copy(sources, c.sources)
+	sort.Slice(sources, func(i, j int) bool { return sources[i].src.Path < sources[j].src.Path })
+
+	h := sha256.New()
+	h.Write([]byte(base))
+	for _, ds := range sources {
+		h.Write([]byte(ds.src.Path))
+		h.Write(ds.raw)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// DataStatus devuelve el estado de cada origen de datos.
+func (c *SdkClient) DataStatus() []DataSourceStatus {
+	c.dataMu.Lock()
+	defer c.dataMu.Unlock()
+
+	now := time.Now()
+	status := make([]DataSourceStatus, 0, len(c.sources))
+	for _, ds := range c.sources {
+		s := DataSourceStatus{
+			Path:        ds.src.Path,
+			LastSuccess: ds.lastSuccess,
+			LastAttempt: ds.lastAttempt,
+			Failures:    ds.failures,
+			Staleness:   now.Sub(ds.lastSuccess),
+		}
+		if ds.lastErr != nil {
+			s.LastError = ds.lastErr.Error()
+		}
+		status = append(status, s)
+	}
+	return status
+}
+
+// DataChecker es una comprobación de salud que falla si algún origen de datos
+// lleva más de su MaxAge sin actualizarse.
+func (c *SdkClient) DataChecker() port.Checker {
+	return dataChecker{c}
+}
+
+type dataChecker struct {
+	client *SdkClient
+}
+
+func (d dataChecker) Check() error {
+	var stale []string
+	for i, s := range d.client.DataStatus() {
+		maxAge := d.client.sources[i].src.MaxAge
+		if maxAge > 0 && s.Staleness > maxAge {
+			stale = append(stale, fmt.Sprintf("%s (%s)", s.Path, s.Staleness.Truncate(time.Second)))
+		}
+	}
+	if len(stale) > 0 {
+		return fmt.Errorf("datos de OPA desactualizados: %s", strings.Join(stale, ", "))
+	}
+	return nil
+}
+
+// HttpDataProvider obtiene el documento con un GET que debe responder JSON.
+func HttpDataProvider(url string, client *http.Client) DataProvider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return DataProviderFunc(func(ctx context.Context) (any, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			return nil, fmt.Errorf("%s respondió %d: %s", url, resp.StatusCode, strings.TrimSpace(string(msg)))
+		}
+
+		var doc any
+		if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+			return nil, fmt.Errorf("respuesta de %s inválida: %w", url, err)
+		}
+		return doc, nil
+	})
+}
+
+// SQLDataProvider ejecuta la consulta y devuelve las filas como una lista de
+// objetos {columna: valor}. Para otras formas (p.ej. un mapa de rol a
+// permisos) usar DataProviderFunc.
+func SQLDataProvider(db *sql.DB, query string, args ...any) DataProvider {
+	return DataProviderFunc(func(ctx context.Context) (any, error) {
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		columns, err := rows.Columns()
+		if err != nil {
+			return nil, err
+		}
+
+		result := []any{}
+		for rows.Next() {
+			values := make([]any, len(columns))
+			ptrs := make([]any, len(columns))
+			for i := range values {
+				ptrs[i] = &values[i]
+			}
+			if err := rows.Scan(ptrs...); err != nil {
+				return nil, err
+			}
+
+			row := make(map[string]any, len(columns))
+			for i, column := range columns {
+				if b, ok := values[i].([]byte); ok {
+					row[column] = string(b)
+				} else {
+					row[column] = values[i]
+				}
+			}
+			result = append(result, row)
+		}
+		return result, rows.Err()
+	})
+}
@@ -0,0 +1,144 @@
+package opa
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/norlis/httpgate/pkg/domain"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const rolesPolicy = `package authz
+
+default allow := false
+
+allow if {
+	some role in input.payload.roles
+	input.action in data.grants[role]
+}
+`
+
+func TestSdkClient_DataSources(t *testing.T) {
+	dir := t.TempDir()
+	writePolicy(t, dir, rolesPolicy)
+
+	var grants atomic.Value
+	grants.Store(map[string]any{"viewer": []string{"GET:/api/test"}})
+	var fail atomic.Bool
+	provider := DataProviderFunc(func(context.Context) (any, error) {
+		if fail.Load() {
+			return nil, errors.New("database unavailable")
+		}
+		return grants.Load(), nil
+	})
+
+	client := newTestClient(t, Config{
+		Query:        "data.authz.allow",
+		PoliciesPath: dir,
+		DataSources:  []DataSource{{Path: "grants", Provider: provider, MaxAge: time.Hour}},
+	})
+
+	allowed := func(action string) bool {
+		t.Helper()
+		ok, err := client.IsAllowed(context.Background(), domain.PolicyInput{
+			Payload: map[string]any{"roles": []string{"viewer"}},
+			Action:  action,
+		})
+		if err != nil {
+			t.Fatalf("IsAllowed() error = %v", err)
+		}
+		return ok
+	}
+
+	if !allowed("GET:/api/test") || allowed("DELETE:/api/test") {
+		t.Fatal("initial grants not applied")
+	}
+	revision := client.Revision()
+
+	grants.Store(map[string]any{"viewer": []string{"GET:/api/test", "DELETE:/api/test"}})
+	if err := client.RefreshData(context.Background()); err != nil {
+		t.Fatalf("RefreshData() error = %v", err)
+	}
+	if !allowed("DELETE:/api/test") {
+		t.Error("updated grants not applied")
+	}
+	if client.Revision() == revision {
+		t.Error("Revision() did not change after data update")
+	}
+
+	// Si el origen falla se mantiene el último documento válido.
+	revision = client.Revision()
+	fail.Store(true)
+	if err := client.RefreshData(context.Background()); err == nil {
+		t.Error("RefreshData() error = nil, want error")
+	}
+	if !allowed("DELETE:/api/test") || client.Revision() != revision {
+		t.Error("last good data not kept after failure")
+	}
+	if status := client.DataStatus(); len(status) != 1 || status[0].Failures != 1 || status[0].LastError == "" {
+		t.Errorf("DataStatus() = %+v, want 1 failure", status)
+	}
+	if err := client.DataChecker().Check(); err != nil {
+		t.Errorf("Check() error = %v, want nil within MaxAge", err)
+	}
+
+	// Una recarga de las políticas conserva los datos de los orígenes.
+	writePolicy(t, dir, rolesPolicy+"\n# cambio\n")
+	if err := client.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if !allowed("DELETE:/api/test") {
+		t.Error("data source lost after Reload")
+	}
+}
+
+func TestHttpDataProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"viewer": ["GET:/api/test"]}`))
+	}))
+	defer srv.Close()
+
+	reg := prometheus.NewRegistry()
+	metrics, err := NewMetrics(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	writePolicy(t, dir, rolesPolicy)
+	client := newTestClient(t, Config{
+		Query:        "data.authz.allow",
+		PoliciesPath: dir,
+		DataSources:  []DataSource{{Path: "grants", Provider: HttpDataProvider(srv.URL, nil)}},
+		Metrics:      metrics,
+	})
+
+	ok, err := client.IsAllowed(context.Background(), domain.PolicyInput{
+		Payload: map[string]any{"roles": []string{"viewer"}},
+		Action:  "GET:/api/test",
+	})
+	if err != nil || !ok {
+		t.Errorf("IsAllowed() = %v, %v, want true", ok, err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lastSuccess float64
+	for _, family := range families {
+		if family.GetName() == "httpgate_opa_data_last_success_timestamp_seconds" {
+			lastSuccess = family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	if lastSuccess <= 0 {
+		t.Errorf("data_last_success_timestamp_seconds = %v, want the fetch time", lastSuccess)
+	}
+}
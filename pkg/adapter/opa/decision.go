@@ -0,0 +1,55 @@
+package opa
+
+import (
+	"fmt"
+
+	"github.com/norlis/httpgate/pkg/domain"
+)
+
+// decisionFromResult interpreta el valor devuelto por la consulta. Se aceptan
+// dos formas: un booleano (data.authz.allow) o un objeto con la decisión
+// completa (data.authz.decision):
+//
+//	{"allow": true, "reasons": ["..."], "obligations": {"headers": {"X-Foo": "bar"}}}
+func decisionFromResult(value any) (domain.Decision, error) {
+	switch v := value.(type) {
+	case nil:
+		// Un resultado indefinido equivale a no tener permiso.
+		return domain.Decision{}, nil
+	case bool:
+		return domain.Decision{Allow: v}, nil
+	case map[string]any:
+		return decisionFromObject(v)
+	default:
+		return domain.Decision{}, fmt.Errorf("la política de OPA no devolvió un resultado booleano")
+	}
+}
+
+func decisionFromObject(obj map[string]any) (domain.Decision, error) {
+	var decision domain.Decision
+
+	allow, ok := obj["allow"].(bool)
+	if !ok {
+		return decision, fmt.Errorf("la decisión de OPA no tiene un campo allow booleano")
+	}
+	decision.Allow = allow
+
+	if reasons, ok := obj["reasons"].([]any); ok {
+		for _, reason := range reasons {
+			if s, ok := reason.(string); ok {
+				decision.Reasons = append(decision.Reasons, s)
+			}
+		}
+	}
+
+	if obligations, ok := obj["obligations"].(map[string]any); ok {
+		if headers, ok := obligations["headers"].(map[string]any); ok {
+			decision.Obligations.Headers = make(map[string]string, len(headers))
+			for name, value := range headers {
+				decision.Obligations.Headers[name] = fmt.Sprint(value)
+			}
+		}
+	}
+
+	return decision, nil
+}
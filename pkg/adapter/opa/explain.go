@@ -0,0 +1,50 @@
+package opa
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/topdown"
+	"github.com/open-policy-agent/opa/v1/topdown/lineage"
+)
+
+// ExplainMode indica qué parte de la traza de rego se adjunta a las decisiones
+// que piden explicación (port.WithExplain). Capturar la traza es costoso y
+// expone el input y la política, así que no debe habilitarse en producción.
+type ExplainMode string
+
+const (
+	ExplainOff   ExplainMode = ""      // no se explica ninguna decisión (por defecto)
+	ExplainFails ExplainMode = "fails" // las expresiones que fallaron y las reglas que las contienen
+	ExplainNotes ExplainMode = "notes" // solo las llamadas a trace() de la política
+	ExplainFull  ExplainMode = "full"  // la traza completa
+)
+
+func (m ExplainMode) validate() error {
+	switch m {
+	case ExplainOff, ExplainFails, ExplainNotes, ExplainFull:
+		return nil
+	}
+	return fmt.Errorf("modo de explicación de OPA no soportado: %q", m)
+}
+
+// render filtra la traza según el modo y la devuelve en el formato de opa eval --explain.
+func (m ExplainMode) render(trace topdown.BufferTracer) []string {
+	events := []*topdown.Event(trace)
+	switch m {
+	case ExplainFails:
+		events = lineage.Fails(events)
+	case ExplainNotes:
+		events = lineage.Notes(events)
+	default:
+		events = lineage.Full(events)
+	}
+
+	var buf bytes.Buffer
+	topdown.PrettyTraceWithLocation(&buf, events)
+	if buf.Len() == 0 {
+		return []string{}
+	}
+	return strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+}
@@ -0,0 +1,270 @@
+package opa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/norlis/httpgate/pkg/domain"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultHttpTimeout      = 2 * time.Second
+	defaultHttpMaxIdleConns = 100
+	defaultHttpRetryBackoff = 50 * time.Millisecond
+	defaultHttpMaxRetries   = 2
+)
+
+// HttpConfig configura el acceso a un servidor OPA remoto (por ejemplo un sidecar)
+// a través de la Data API REST.
+type HttpConfig struct {
+	URL          string        `yaml:"url"`          // http://localhost:8181
+	Query        string        `yaml:"query"`        // data.authz.allow, se traduce a /v1/data/authz/allow
+	Timeout      time.Duration `yaml:"timeout"`      // tiempo máximo por intento
+	MaxIdleConns int           `yaml:"maxIdleConns"` // conexiones reutilizables hacia el servidor
+	MaxRetries   int           `yaml:"maxRetries"`   // reintentos ante errores transitorios, por defecto 2; negativo para no reintentar
+	RetryBackoff time.Duration `yaml:"retryBackoff"` // espera base entre reintentos, crece linealmente
+
+	// Queries son consultas adicionales por nombre, igual que en Config.
+	Queries map[string]string `yaml:"queries"`
+
+	// Metrics, si se define, publica la latencia de cada consulta en Prometheus.
+	Metrics *Metrics `yaml:"-"`
+}
+
+// HttpClient evalúa las políticas en un servidor OPA remoto. Cada consulta pide
+// la procedencia (?provenance=true) para informar en la decisión la revisión
+// de los bundles del servidor; Revision devuelve la última observada, así que
+// una caché por encima (decisioncache) se invalida en cuanto alguna consulta
+// que llega al servidor ve una recarga.
+type HttpClient struct {
+	endpoint   string
+	cfg        HttpConfig
+	httpClient *http.Client
+	logger     *zap.Logger
+	revision   atomic.Pointer[string]
+}
+
+// dataRequest y dataResponse son los cuerpos de POST /v1/data/<path>.
+type dataRequest struct {
+	Input domain.PolicyInput `json:"input"`
+}
+
+type dataResponse struct {
+	Result     any         `json:"result"`
+	DecisionID string      `json:"decision_id,omitempty"`
+	Provenance *provenance `json:"provenance,omitempty"`
+}
+
+// provenance es la procedencia que devuelve OPA con ?provenance=true. Los
+// servidores con un solo bundle antiguo informan revision; el resto, una
+// revisión por bundle.
+type provenance struct {
+	Revision string `json:"revision,omitempty"`
+	Bundles  map[string]struct {
+		Revision string `json:"revision"`
+	} `json:"bundles,omitempty"`
+}
+
+// revision combina las revisiones de los bundles en un solo identificador.
+func (p *provenance) revision() string {
+	if p == nil {
+		return ""
+	}
+	if p.Revision != "" || len(p.Bundles) == 0 {
+		return p.Revision
+	}
+
+	names := make([]string, 0, len(p.Bundles))
+	for name := range p.Bundles {
+		names = append(names, name)
+	}
+	if len(names) == 1 {
+		return p.Bundles[names[0]].Revision
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + ":" + p.Bundles[name].Revision
+	}
+	return strings.Join(parts, ",")
+}
+
+// errTransient marca los fallos que vale la pena reintentar.
+var errTransient = errors.New("error transitorio")
+
+func NewOpaHttpClientFromConfig(cfg HttpConfig, logger *zap.Logger) (*HttpClient, error) {
+	if cfg.URL == "" || cfg.Query == "" {
+		return nil, fmt.Errorf("la url y la consulta de OPA no pueden estar vacías")
+	}
+
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultHttpTimeout
+	}
+	if cfg.MaxIdleConns <= 0 {
+		cfg.MaxIdleConns = defaultHttpMaxIdleConns
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = defaultHttpMaxRetries
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = defaultHttpRetryBackoff
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = cfg.MaxIdleConns
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConns
+
+	return &HttpClient{
+		endpoint: dataEndpoint(cfg.URL, cfg.Query),
+		cfg:      cfg,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Timeout,
+		},
+		logger: logger.Named("OPA").With(zap.String("query", cfg.Query)),
+	}, nil
+}
+
+// dataEndpoint devuelve la url de la Data API para la consulta, pidiendo la procedencia.
+func dataEndpoint(url, query string) string {
+	return strings.TrimSuffix(url, "/") + "/v1/data/" + queryToPath(query) + "?provenance=true"
+}
+
+// queryToPath convierte "data.authz.allow" en "authz/allow".
+func queryToPath(query string) string {
+	query = strings.TrimPrefix(query, "data.")
+	return strings.ReplaceAll(query, ".", "/")
+}
+
+// Decide consulta al servidor OPA remoto con el input proporcionado y devuelve la decisión completa.
+func (c *HttpClient) Decide(ctx context.Context, input domain.PolicyInput) (domain.Decision, error) {
+	return c.decide(ctx, c.cfg.Query, c.endpoint, input)
+}
+
+// DecideQuery consulta otro documento del servidor OPA, por nombre de
+// HttpConfig.Queries o como consulta, p.ej. "data.documents.allow".
+func (c *HttpClient) DecideQuery(ctx context.Context, query string, input domain.PolicyInput) (domain.Decision, error) {
+	resolved := query
+	if q, ok := c.cfg.Queries[query]; ok {
+		resolved = q
+	}
+	if resolved == "" {
+		return c.Decide(ctx, input)
+	}
+	return c.decide(ctx, query, dataEndpoint(c.cfg.URL, resolved), input)
+}
+
+func (c *HttpClient) decide(ctx context.Context, query, endpoint string, input domain.PolicyInput) (decision domain.Decision, err error) {
+	start := time.Now()
+	defer func() {
+		c.cfg.Metrics.observeDecision(queryLabel(c.cfg.Query, c.cfg.Queries, query), decision, err, time.Since(start))
+	}()
+
+	body, err := json.Marshal(dataRequest{Input: input})
+	if err != nil {
+		return domain.Decision{}, fmt.Errorf("error al serializar el input de OPA: %w", err)
+	}
+
+	var res dataResponse
+	for attempt := 0; ; attempt++ {
+		res, err = c.post(ctx, endpoint, body)
+		if err == nil || !errors.Is(err, errTransient) || attempt >= c.cfg.MaxRetries {
+			break
+		}
+
+		c.logger.Debug("reintentando consulta a OPA", zap.Int("attempt", attempt+1), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return domain.Decision{}, fmt.Errorf("error al evaluar la política de OPA: %w", ctx.Err())
+		case <-time.After(c.cfg.RetryBackoff * time.Duration(attempt+1)):
+		}
+	}
+	if err != nil {
+		return domain.Decision{}, fmt.Errorf("error al evaluar la política de OPA: %w", err)
+	}
+
+	decision, err = decisionFromResult(res.Result)
+	if err != nil {
+		return domain.Decision{}, err
+	}
+
+	decision.ID = res.DecisionID
+	if decision.ID == "" {
+		decision.ID = domain.NewDecisionID()
+	}
+	if revision := res.Provenance.revision(); revision != "" {
+		decision.Revision = revision
+		c.revision.Store(&revision)
+	}
+
+	return decision, nil
+}
+
+// Revision es la revisión de políticas que informó el servidor en la última
+// consulta, o "" si el servidor no usa bundles.
+func (c *HttpClient) Revision() string {
+	if revision := c.revision.Load(); revision != nil {
+		return *revision
+	}
+	return ""
+}
+
+// IsAllowed consulta al servidor OPA remoto con el input proporcionado.
+// Se mantiene por compatibilidad, usar Decide para obtener el detalle.
+func (c *HttpClient) IsAllowed(ctx context.Context, input domain.PolicyInput) (bool, error) {
+	decision, err := c.Decide(ctx, input)
+	return decision.Allow, err
+}
+
+func (c *HttpClient) post(ctx context.Context, endpoint string, body []byte) (dataResponse, error) {
+	var res dataResponse
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return res, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		var netErr net.Error
+		if ctx.Err() == nil && (errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)) {
+			return res, fmt.Errorf("%w: %w", errTransient, err)
+		}
+		return res, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err = fmt.Errorf("OPA respondió %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return res, fmt.Errorf("%w: %w", errTransient, err)
+		}
+		return res, err
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return res, fmt.Errorf("respuesta de OPA inválida: %w", err)
+	}
+
+	return res, nil
+}
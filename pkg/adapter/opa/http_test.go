@@ -0,0 +1,153 @@
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/norlis/httpgate/pkg/domain"
+)
+
+func TestHttpClient_IsAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  string
+		want    bool
+		wantErr bool
+	}{
+		{name: "allow", result: `{"result": true}`, want: true},
+		{name: "deny", result: `{"result": false}`, want: false},
+		{name: "undefined", result: `{}`, want: false},
+		{name: "decision object", result: `{"result": {"allow": true, "reasons": ["admin"]}}`, want: true},
+		{name: "not boolean", result: `{"result": "yes"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/v1/data/authz/allow" {
+					t.Errorf("request = %s %s, want POST /v1/data/authz/allow", r.Method, r.URL.Path)
+				}
+				var body dataRequest
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Input.Action != "GET:/api/test" {
+					t.Errorf("input = %+v (%v), want action GET:/api/test", body.Input, err)
+				}
+				_, _ = w.Write([]byte(tt.result))
+			}))
+			defer srv.Close()
+
+			client, err := NewOpaHttpClientFromConfig(HttpConfig{URL: srv.URL, Query: "data.authz.allow"}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := client.IsAllowed(context.Background(), domain.PolicyInput{Action: "GET:/api/test"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("IsAllowed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("IsAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHttpClient_RetriesTransientErrors(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"result": true}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewOpaHttpClientFromConfig(HttpConfig{URL: srv.URL, Query: "data.authz.allow", MaxRetries: 2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allowed, err := client.IsAllowed(context.Background(), domain.PolicyInput{Action: "GET:/api/test"})
+	if err != nil || !allowed {
+		t.Fatalf("IsAllowed() = %v, %v, want true, nil", allowed, err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("calls = %d, want 3", calls.Load())
+	}
+}
+
+func TestHttpClient_MaxRetriesDefault(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxRetries int
+		want       int32
+	}{
+		{name: "default", maxRetries: 0, want: 3},
+		{name: "disabled", maxRetries: -1, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer srv.Close()
+
+			client, err := NewOpaHttpClientFromConfig(HttpConfig{URL: srv.URL, Query: "data.authz.allow", MaxRetries: tt.maxRetries}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := client.IsAllowed(context.Background(), domain.PolicyInput{Action: "GET:/api/test"}); err == nil {
+				t.Error("IsAllowed() error = nil, want error")
+			}
+			if calls.Load() != tt.want {
+				t.Errorf("calls = %d, want %d", calls.Load(), tt.want)
+			}
+		})
+	}
+}
+
+func TestHttpClient_RevisionFromProvenance(t *testing.T) {
+	var revision atomic.Pointer[string]
+	first := "v1"
+	revision.Store(&first)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("provenance") != "true" {
+			t.Errorf("query = %s, want provenance=true", r.URL.RawQuery)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"result":     true,
+			"provenance": map[string]any{"bundles": map[string]any{"authz": map[string]any{"revision": *revision.Load()}}},
+		})
+	}))
+	defer srv.Close()
+
+	client, err := NewOpaHttpClientFromConfig(HttpConfig{URL: srv.URL, Query: "data.authz.allow"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decision, err := client.Decide(context.Background(), domain.PolicyInput{Action: "GET:/api/test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.Revision != "v1" || client.Revision() != "v1" {
+		t.Errorf("Revision = %q, %q, want v1", decision.Revision, client.Revision())
+	}
+
+	second := "v2"
+	revision.Store(&second)
+	if _, err := client.Decide(context.Background(), domain.PolicyInput{Action: "GET:/api/test"}); err != nil {
+		t.Fatal(err)
+	}
+	if client.Revision() != "v2" {
+		t.Errorf("Revision() = %q after reload, want v2", client.Revision())
+	}
+}
@@ -0,0 +1,89 @@
+package opa
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/loader"
+)
+
+// loadedPolicies es el resultado de leer una fuente de políticas, ya sea un
+// directorio con archivos sueltos o un bundle.
+type loadedPolicies struct {
+	modules   map[string]*ast.Module
+	documents map[string]any
+	revision  string
+	// digest resume el contenido cargado. Un bundle puede cambiar sin cambiar
+	// la revisión de su manifiesto, así que los cambios se detectan por digest
+	// y la revisión solo se informa.
+	digest string
+	etag   string // ETag del bundle remoto, ver bundleSource.accept
+}
+
+// policyPaths devuelve las rutas locales que se cargan (y se observan) según la configuración.
+func policyPaths(cfg Config) []string {
+	if cfg.Bundle != nil {
+		if cfg.Bundle.Path == "" {
+			return nil
+		}
+		return []string{cfg.Bundle.Path}
+	}
+	return append([]string{cfg.PoliciesPath}, cfg.DataFiles...)
+}
+
+// loadPolicies lee los módulos rego y los documentos de datos configurados.
+func (c *SdkClient) loadPolicies(ctx context.Context) (*loadedPolicies, error) {
+	if c.cfg.Bundle != nil {
+		return c.bundles.read(ctx)
+	}
+
+	fl := loader.NewFileLoader()
+	if c.cfg.FS != nil {
+		fl = fl.WithFS(c.cfg.FS)
+	}
+
+	result, err := fl.Filtered(policyPaths(c.cfg), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	revision := revisionOf(result)
+	return &loadedPolicies{
+		modules:   result.ParsedModules(),
+		documents: result.Documents,
+		revision:  revision,
+		digest:    revision,
+	}, nil
+}
+
+// revisionOf calcula un identificador estable del contenido cargado, de modo que
+// dos cargas con los mismos módulos y datos producen la misma revisión.
+func revisionOf(result *loader.Result) string {
+	names := make([]string, 0, len(result.Modules))
+	for name := range result.Modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		h.Write([]byte(name))
+		h.Write(result.Modules[name].Raw)
+	}
+
+	// json.Marshal ordena las claves de los mapas, por lo que el resultado es determinista.
+	data, _ := json.Marshal(result.Documents)
+	h.Write(data)
+
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// revisionOfBytes calcula la revisión de un bundle que no declara una en su manifiesto.
+func revisionOfBytes(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])[:16]
+}
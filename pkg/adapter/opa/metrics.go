@@ -0,0 +1,139 @@
+package opa
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/norlis/httpgate/pkg/domain"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Valores de la etiqueta query para la consulta por defecto y para las consultas
+// de rego que no están registradas en Config.Queries.
+const (
+	queryDefault = "default"
+	queryOther   = "other"
+)
+
+// Valores de la etiqueta result de httpgate_opa_eval_duration_seconds.
+const (
+	resultAllow     = "allow"
+	resultDeny      = "deny"
+	resultDefined   = "defined"   // Eval con resultado
+	resultUndefined = "undefined" // Eval sin resultado
+	resultError     = "error"
+	resultTimeout   = "timeout"
+)
+
+// ErrEvalTimeout indica que la evaluación superó Config.EvalTimeout.
+var ErrEvalTimeout = errors.New("la evaluación de la política de OPA superó el tiempo máximo")
+
+// Metrics publica en Prometheus la latencia de las evaluaciones, por consulta
+// y resultado, la duración de la compilación de las políticas y el momento de
+// la última actualización correcta de cada DataSource (la antigüedad de los
+// datos es time() menos ese valor). Se puede compartir entre varios clientes;
+// un *Metrics nil no registra nada.
+type Metrics struct {
+	evalDuration    *prometheus.HistogramVec
+	compileDuration prometheus.Histogram
+	dataLastSuccess *prometheus.GaugeVec
+}
+
+// NewMetrics crea y registra las métricas en reg, o en el registro por defecto si es nil.
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	m := &Metrics{
+		evalDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "httpgate",
+			Subsystem: "opa",
+			Name:      "eval_duration_seconds",
+			Help:      "Duración de las evaluaciones de políticas de OPA por consulta (default, nombre configurado u other) y resultado.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 15), // 100µs - 1.6s
+		}, []string{"query", "result"}),
+		compileDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "httpgate",
+			Subsystem: "opa",
+			Name:      "compile_duration_seconds",
+			Help:      "Duración de la carga y compilación de las políticas de OPA.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		dataLastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "httpgate",
+			Subsystem: "opa",
+			Name:      "data_last_success_timestamp_seconds",
+			Help:      "Momento (Unix) de la última actualización correcta de cada origen de datos de OPA.",
+		}, []string{"path"}),
+	}
+
+	for _, c := range []prometheus.Collector{m.evalDuration, m.compileDuration, m.dataLastSuccess} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *Metrics) observeEval(query, result string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.evalDuration.WithLabelValues(query, result).Observe(d.Seconds())
+}
+
+func (m *Metrics) observeDecision(query string, decision domain.Decision, err error, d time.Duration) {
+	m.observeEval(query, decisionResult(decision, err), d)
+}
+
+func (m *Metrics) observeCompile(d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.compileDuration.Observe(d.Seconds())
+}
+
+func (m *Metrics) observeDataSuccess(path string, at time.Time) {
+	if m == nil {
+		return
+	}
+	m.dataLastSuccess.WithLabelValues(path).Set(float64(at.UnixNano()) / 1e9)
+}
+
+// queryLabel acota la etiqueta query a las consultas configuradas: la consulta
+// por defecto, el nombre de las de Config.Queries (o HttpConfig.Queries) y
+// "other" para cualquier consulta de rego ad hoc, como Requirements.Query.
+func queryLabel(defaultQuery string, queries map[string]string, query string) string {
+	if query == "" || query == defaultQuery {
+		return queryDefault
+	}
+	if _, ok := queries[query]; ok {
+		return query
+	}
+	for name, registered := range queries {
+		if registered == query {
+			return name
+		}
+	}
+	return queryOther
+}
+
+func decisionResult(decision domain.Decision, err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrEvalTimeout), errors.Is(err, context.DeadlineExceeded):
+		return resultTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return resultTimeout
+	case err != nil:
+		return resultError
+	case decision.Allow:
+		return resultAllow
+	default:
+		return resultDeny
+	}
+}
@@ -0,0 +1,106 @@
+package opa
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/norlis/httpgate/pkg/domain"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const slowPolicy = `package authz
+
+default allow := false
+
+allow if input.action == "GET:/api/test"
+
+allow if {
+	input.action == "GET:/api/slow"
+	some i in numbers.range(1, 100000000)
+	i < 0
+}
+`
+
+func TestSdkClient_EvalTimeout(t *testing.T) {
+	dir := t.TempDir()
+	writePolicy(t, dir, slowPolicy)
+
+	client := newTestClient(t, Config{Query: "data.authz.allow", PoliciesPath: dir, EvalTimeout: 20 * time.Millisecond})
+
+	if !isAllowed(t, client) {
+		t.Error("IsAllowed() = false, want true for a fast evaluation")
+	}
+
+	start := time.Now()
+	_, err := client.Decide(context.Background(), domain.PolicyInput{Action: "GET:/api/slow"})
+	if !errors.Is(err, ErrEvalTimeout) {
+		t.Fatalf("Decide() error = %v, want ErrEvalTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Decide() took %s, want it cut at EvalTimeout", elapsed)
+	}
+}
+
+func TestSdkClient_Metrics(t *testing.T) {
+	dir := t.TempDir()
+	writePolicy(t, dir, slowPolicy)
+
+	reg := prometheus.NewRegistry()
+	metrics, err := NewMetrics(reg)
+	if err != nil {
+		t.Fatalf("NewMetrics() error = %v", err)
+	}
+
+	client := newTestClient(t, Config{
+		Query:        "data.authz.allow",
+		PoliciesPath: dir,
+		EvalTimeout:  20 * time.Millisecond,
+		Instrument:   true,
+		Profile:      true,
+		Metrics:      metrics,
+		Queries:      map[string]string{"named": "data.authz.named"},
+	})
+
+	for _, action := range []string{"GET:/api/test", "GET:/api/test", "DELETE:/api/test", "GET:/api/slow"} {
+		_, _ = client.Decide(context.Background(), domain.PolicyInput{Action: action})
+	}
+	// Las consultas con nombre se etiquetan por nombre y las consultas ad hoc
+	// como "other", para acotar la cardinalidad.
+	test := domain.PolicyInput{Action: "GET:/api/test"}
+	_, _ = client.DecideQuery(context.Background(), "named", test)
+	_, _ = client.DecideQuery(context.Background(), "data.authz.named", test)
+	_, _ = client.DecideQuery(context.Background(), `data.authz.allow with input.action as "GET:/api/test"`, test)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]uint64{}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			key := family.GetName()
+			for _, label := range m.GetLabel() {
+				key += " " + label.GetName() + "=" + label.GetValue()
+			}
+			got[key] = m.GetHistogram().GetSampleCount()
+		}
+	}
+
+	want := map[string]uint64{
+		"httpgate_opa_compile_duration_seconds":                           1,
+		"httpgate_opa_eval_duration_seconds query=default result=allow":   2,
+		"httpgate_opa_eval_duration_seconds query=default result=deny":    1,
+		"httpgate_opa_eval_duration_seconds query=default result=timeout": 1,
+		"httpgate_opa_eval_duration_seconds query=named result=deny":      2,
+		"httpgate_opa_eval_duration_seconds query=other result=allow":     1,
+	}
+	for key, count := range want {
+		if got[key] != count {
+			t.Errorf("%s = %d, want %d", key, got[key], count)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/norlis/httpgate/pkg/domain"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/rego"
+)
+
+// resourceRef es la parte del input que se considera desconocida en la
+// evaluación parcial: el filtro se expresa sobre sus campos.
+var resourceRef = ast.MustParseRef("input.resource")
+
+// Filter evalúa parcialmente la consulta dejando input.resource como
+// desconocido y traduce las condiciones residuales a un domain.Filter.
+// La consulta (o su nombre en Config.Queries) debe ser booleana, p.ej. "data.documents.allow". Si la política
+// usa construcciones que no se pueden expresar como filtro (funciones,
+// iteraciones sobre el recurso) devuelve error.
+func (c *SdkClient) Filter(ctx context.Context, query string, input domain.PolicyInput) (domain.Filter, error) {
+	query = c.resolve(query)
+	if query == "" {
+		query = c.cfg.Query
+	}
+	state := c.state.Load()
+	input.Resource = nil
+
+	ctx, cancel := c.evalContext(ctx)
+	defer cancel()
+
+	pq, err := rego.New(
+		rego.Query(query+" == true"),
+		rego.Compiler(state.compiler),
+		rego.Store(state.store),
+		rego.Input(input),
+		rego.Unknowns([]string{resourceRef.String()}),
+	).Partial(ctx)
+	if err != nil {
+		return domain.Filter{}, fmt.Errorf("error en la evaluación parcial de OPA: %w", err)
+	}
+	if len(pq.Support) > 0 {
+		return domain.Filter{}, fmt.Errorf("la consulta %q requiere reglas de soporte y no se puede traducir a un filtro", query)
+	}
+
+	// Cada query residual es una alternativa (or) y sus expresiones se cumplen todas (and).
+	alternatives := make([]domain.Filter, 0, len(pq.Queries))
+	for _, body := range pq.Queries {
+		conditions := make([]domain.Filter, 0, len(body))
+		for _, expr := range body {
+			f, err := filterFromExpr(expr)
+			if err != nil {
+				return domain.Filter{}, err
+			}
+			conditions = append(conditions, f)
+		}
+		alternatives = append(alternatives, combine(domain.FilterAnd, domain.FilterTrue, conditions))
+	}
+
+	return combine(domain.FilterOr, domain.FilterFalse, alternatives), nil
+}
+
+// combine une las condiciones con op; sin condiciones devuelve empty.
+func combine(op, empty domain.FilterOp, filters []domain.Filter) domain.Filter {
+	switch len(filters) {
+	case 0:
+		return domain.Filter{Op: empty}
+	case 1:
+		return filters[0]
+	}
+	for _, f := range filters {
+		// Una alternativa sin condiciones permite todo.
+		if op == domain.FilterOr && f.Op == domain.FilterTrue {
+			return f
+		}
+	}
+	return domain.Filter{Op: op, Args: filters}
+}
+
+var comparisons = map[string]domain.FilterOp{
+	ast.Equality.Name:      domain.FilterEq,
+	ast.Equal.Name:         domain.FilterEq,
+	ast.NotEqual.Name:      domain.FilterNe,
+	ast.LessThan.Name:      domain.FilterLt,
+	ast.LessThanEq.Name:    domain.FilterLte,
+	ast.GreaterThan.Name:   domain.FilterGt,
+	ast.GreaterThanEq.Name: domain.FilterGte,
+	ast.Member.Name:        domain.FilterIn,
+}
+
+// flipped es el operador equivalente cuando el campo está a la derecha.
+var flipped = map[domain.FilterOp]domain.FilterOp{
+	domain.FilterLt:  domain.FilterGt,
+	domain.FilterLte: domain.FilterGte,
+	domain.FilterGt:  domain.FilterLt,
+	domain.FilterGte: domain.FilterLte,
+}
+
+func filterFromExpr(expr *ast.Expr) (domain.Filter, error) {
+	if expr.Negated {
+		inner := expr.Copy()
+		inner.Negated = false
+		f, err := filterFromExpr(inner)
+		if err != nil {
+			return domain.Filter{}, err
+		}
+		return domain.Filter{Op: domain.FilterNot, Args: []domain.Filter{f}}, nil
+	}
+
+	// input.resource.published: el campo debe ser verdadero.
+	if term, ok := expr.Terms.(*ast.Term); ok {
+		if field, ok := resourceField(term); ok {
+			return domain.Filter{Op: domain.FilterEq, Field: field, Value: true}, nil
+		}
+		return domain.Filter{}, fmt.Errorf("expresión no soportada en el filtro: %v", expr)
+	}
+
+	if !expr.IsCall() || len(expr.Operands()) != 2 {
+		return domain.Filter{}, fmt.Errorf("expresión no soportada en el filtro: %v", expr)
+	}
+	op, ok := comparisons[expr.Operator().String()]
+	if !ok {
+		return domain.Filter{}, fmt.Errorf("operador no soportado en el filtro: %v", expr.Operator())
+	}
+
+	left, right := expr.Operand(0), expr.Operand(1)
+	if field, ok := resourceField(left); ok {
+		return comparison(op, field, right, expr)
+	}
+	if field, ok := resourceField(right); ok && op != domain.FilterIn {
+		if f, ok := flipped[op]; ok {
+			op = f
+		}
+		return comparison(op, field, left, expr)
+	}
+
+	return domain.Filter{}, fmt.Errorf("expresión no soportada en el filtro: %v", expr)
+}
+
+func comparison(op domain.FilterOp, field string, operand *ast.Term, expr *ast.Expr) (domain.Filter, error) {
+	if !operand.IsGround() {
+		return domain.Filter{}, fmt.Errorf("expresión no soportada en el filtro: %v", expr)
+	}
+	value, err := ast.JSON(operand.Value)
+	if err != nil {
+		return domain.Filter{}, err
+	}
+	return domain.Filter{Op: op, Field: field, Value: plainNumbers(value)}, nil
+}
+
+// plainNumbers convierte los json.Number de ast.JSON en int64 o float64, para
+// que los valores del filtro se puedan usar directamente como parámetros SQL.
+func plainNumbers(v any) any {
+	switch value := v.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		f, _ := value.Float64()
+		return f
+	case []any:
+		for i := range value {
+			value[i] = plainNumbers(value[i])
+		}
+	}
+	return v
+}
+
+// resourceField convierte input.resource.meta.tenant en "meta.tenant".
+func resourceField(term *ast.Term) (string, bool) {
+	ref, ok := term.Value.(ast.Ref)
+	if !ok || len(ref) <= len(resourceRef) || !ref.HasPrefix(resourceRef) {
+		return "", false
+	}
+
+	parts := make([]string, 0, len(ref)-len(resourceRef))
+	for _, t := range ref[len(resourceRef):] {
+		s, ok := t.Value.(ast.String)
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, string(s))
+	}
+	return strings.Join(parts, "."), true
+}
+
+// DecideBatch evalúa todos los inputs con la consulta por defecto y la misma
+// revisión de políticas, aunque ocurra una recarga a mitad del lote.
+func (c *SdkClient) DecideBatch(ctx context.Context, inputs []domain.PolicyInput) ([]domain.Decision, error) {
+	state := c.state.Load()
+
+	decisions := make([]domain.Decision, len(inputs))
+	for i, input := range inputs {
+		decision, err := c.evaluate(ctx, state, c.cfg.Query, state.preparedQuery, input)
+		if err != nil {
+			return nil, err
+		}
+		decisions[i] = decision
+	}
+	return decisions, nil
+}
@@ -0,0 +1,102 @@
+package opa
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/norlis/httpgate/pkg/domain"
+	"github.com/norlis/httpgate/pkg/port"
+)
+
+const documentsPolicy = `package documents
+
+default allow := false
+
+allow if input.resource.owner == input.payload.sub
+
+allow if {
+	input.resource.public
+	input.resource.tenant == input.payload.tenant
+}
+
+allow if {
+	input.resource.status in {"draft", "review"}
+	not input.resource.archived
+	input.resource.meta.level < 3
+}
+
+allow if "admin" in input.payload.roles
+
+by_length if count(input.resource.tags) > 2
+`
+
+func TestSdkClient_Filter(t *testing.T) {
+	dir := t.TempDir()
+	writePolicy(t, dir, documentsPolicy)
+	client := newTestClient(t, Config{Query: "data.documents.allow", PoliciesPath: dir})
+
+	payload := func(roles ...string) domain.PolicyInput {
+		return domain.PolicyInput{Payload: map[string]any{"sub": "u1", "tenant": "acme", "roles": roles}}
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		input   domain.PolicyInput
+		want    domain.Filter
+		wantErr bool
+	}{
+		{
+			name:  "residual conditions",
+			input: payload(),
+			want: domain.Filter{Op: domain.FilterOr, Args: []domain.Filter{
+				{Op: domain.FilterEq, Field: "owner", Value: "u1"},
+				{Op: domain.FilterAnd, Args: []domain.Filter{
+					{Op: domain.FilterEq, Field: "public", Value: true},
+					{Op: domain.FilterEq, Field: "tenant", Value: "acme"},
+				}},
+				{Op: domain.FilterAnd, Args: []domain.Filter{
+					{Op: domain.FilterIn, Field: "status", Value: []any{"draft", "review"}},
+					{Op: domain.FilterNot, Args: []domain.Filter{{Op: domain.FilterEq, Field: "archived", Value: true}}},
+					{Op: domain.FilterLt, Field: "meta.level", Value: int64(3)},
+				}},
+			}},
+		},
+		{name: "unconditional", input: payload("admin"), want: domain.Filter{Op: domain.FilterTrue}},
+		{name: "untranslatable", query: "data.documents.by_length", input: payload(), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := port.Filter(context.Background(), client, tt.query, tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Filter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Filter() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSdkClient_DecideBatch(t *testing.T) {
+	dir := t.TempDir()
+	writePolicy(t, dir, documentsPolicy)
+	client := newTestClient(t, Config{Query: "data.documents.allow", PoliciesPath: dir})
+
+	payload := map[string]any{"sub": "u1"}
+	inputs := []domain.PolicyInput{
+		{Payload: payload, Resource: map[string]any{"owner": "u1"}},
+		{Payload: payload, Resource: map[string]any{"owner": "u2"}},
+		{Payload: payload, Resource: map[string]any{"owner": "u2", "status": "draft", "meta": map[string]any{"level": 1}}},
+	}
+
+	allowed, err := port.IsAllowedBatch(context.Background(), client, inputs)
+	if err != nil {
+		t.Fatalf("IsAllowedBatch() error = %v", err)
+	}
+	if want := []bool{true, false, true}; !reflect.DeepEqual(allowed, want) {
+		t.Errorf("IsAllowedBatch() = %v, want %v", allowed, want)
+	}
+}
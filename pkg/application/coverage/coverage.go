@@ -0,0 +1,291 @@
+// Package coverage cruza las rutas registradas en un http.ServeMux con los
+// datos de autorización (permisos, roles y whitelist) para detectar rutas que
+// ningún rol puede usar y expresiones de permisos que no corresponden a
+// ninguna ruta. Supone la estructura de datos de policies/authz:
+//
+//	data.permissions: {"command.create": ["POST:/command$"]}
+//	data.roles:       {"admin": ["command.create"]}
+//	data.whitelist:   ["GET:/health$"]
+package coverage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/norlis/httpgate/pkg/domain"
+)
+
+// sampleSegment reemplaza a los comodines del patrón ({id}, {path...}) al
+// construir la acción de ejemplo de una ruta.
+const sampleSegment = "1"
+
+// anyMethod son los métodos con los que se prueba una ruta registrada sin método.
+var anyMethod = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// Route es un patrón registrado en el ServeMux.
+type Route struct {
+	Method   string   `json:"method,omitempty"` // vacío si la ruta acepta cualquier método
+	Path     string   `json:"path"`
+	Requires []string `json:"requires,omitempty"` // permisos declarados al registrarla (routes.RequirePermissions)
+	Query    string   `json:"query,omitempty"`    // consulta que decide la ruta si no es la del middleware (routes.WithQuery)
+}
+
+// ParseRoute interpreta un patrón de http.ServeMux, p.ej. "GET /items/{id}".
+// El host, si lo tiene, se descarta.
+func ParseRoute(pattern string) Route {
+	pattern = strings.TrimSpace(pattern)
+
+	var route Route
+	if method, rest, ok := strings.Cut(pattern, " "); ok {
+		route.Method, pattern = strings.ToUpper(method), strings.TrimSpace(rest)
+	}
+	if i := strings.Index(pattern, "/"); i > 0 {
+		pattern = pattern[i:]
+	}
+	route.Path = pattern
+	return route
+}
+
+func (r Route) String() string {
+	if r.Method == "" {
+		return r.Path
+	}
+	return r.Method + " " + r.Path
+}
+
+// Actions devuelve las acciones que armaría AuthorizationMiddleware para una
+// petición a la ruta ("METODO:/ruta"), con los comodines reemplazados por un
+// valor de ejemplo. Es una aproximación: una expresión que exige un formato
+// concreto en el segmento (p.ej. un uuid) no coincidirá.
+func (r Route) Actions() []string {
+	segments := strings.Split(r.Path, "/")
+	for i, segment := range segments {
+		switch {
+		case segment == "{$}":
+			segments[i] = ""
+		case strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}"):
+			segments[i] = sampleSegment
+		}
+	}
+	path := strings.Join(segments, "/")
+
+	methods := anyMethod
+	if r.Method != "" {
+		methods = []string{r.Method}
+	}
+
+	actions := make([]string, len(methods))
+	for i, method := range methods {
+		actions[i] = method + ":" + path
+	}
+	return actions
+}
+
+// Rules son los datos de autorización contra los que se cruzan las rutas.
+type Rules struct {
+	Permissions map[string][]string `json:"permissions"`
+	Roles       map[string][]string `json:"roles"`
+	Whitelist   []string            `json:"whitelist"`
+}
+
+// Evaluator obtiene documentos de OPA, lo implementa opa.SdkClient.
+type Evaluator interface {
+	Eval(ctx context.Context, query string, input domain.PolicyInput) (any, error)
+}
+
+// LoadRules lee data.permissions, data.roles y data.whitelist. Los documentos
+// que no existen quedan vacíos.
+func LoadRules(ctx context.Context, ev Evaluator) (Rules, error) {
+	var rules Rules
+	for query, target := range map[string]any{
+		"data.permissions": &rules.Permissions,
+		"data.roles":       &rules.Roles,
+		"data.whitelist":   &rules.Whitelist,
+	} {
+		value, err := ev.Eval(ctx, query, domain.PolicyInput{})
+		if err != nil {
+			return Rules{}, err
+		}
+		if value == nil {
+			continue
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return Rules{}, err
+		}
+		if err := json.Unmarshal(raw, target); err != nil {
+			return Rules{}, fmt.Errorf("%s no tiene el formato esperado: %w", query, err)
+		}
+	}
+	return rules, nil
+}
+
+// RouteCoverage indica qué permite usar una ruta.
+type RouteCoverage struct {
+	Route       Route    `json:"route"`
+	Whitelisted bool     `json:"whitelisted"`
+	Permissions []string `json:"permissions,omitempty"` // permisos con alguna expresión que coincide con la ruta
+	Roles       []string `json:"roles,omitempty"`       // roles que otorgan alguno de esos permisos
+}
+
+// Covered indica si la ruta está en la whitelist o algún rol la puede usar.
+func (c RouteCoverage) Covered() bool {
+	return c.Whitelisted || len(c.Roles) > 0
+}
+
+// UnusedPattern es una expresión que no coincide con ninguna ruta registrada.
+type UnusedPattern struct {
+	Permission string `json:"permission,omitempty"` // vacío si es de la whitelist
+	Pattern    string `json:"pattern"`
+}
+
+// Report es el resultado de Check.
+type Report struct {
+	Routes         []RouteCoverage `json:"routes"`
+	Uncovered      []Route         `json:"uncovered"`      // rutas sin whitelist ni permiso otorgado a algún rol
+	UnusedPatterns []UnusedPattern `json:"unusedPatterns"` // expresiones que no coinciden con ninguna ruta
+}
+
+// Check cruza las rutas con las reglas. Las expresiones se evalúan igual que
+// regex.match en rego (sin anclar, sintaxis RE2). Una ruta que declara
+// permisos se decide solo con ellos, como en policies/authz: está cubierta si
+// algún rol otorga todos.
+func Check(routes []Route, rules Rules) (Report, error) {
+	grantedBy := map[string][]string{}
+	for role, permissions := range rules.Roles {
+		for _, permission := range permissions {
+			grantedBy[permission] = append(grantedBy[permission], role)
+		}
+	}
+
+	compiled := map[string]*regexp.Regexp{}
+	compile := func(pattern string) (*regexp.Regexp, error) {
+		if re, ok := compiled[pattern]; ok {
+			return re, nil
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("expresión inválida %q: %w", pattern, err)
+		}
+		compiled[pattern] = re
+		return re, nil
+	}
+
+	matchesAny := func(pattern string, actions []string) (bool, error) {
+		re, err := compile(pattern)
+		if err != nil {
+			return false, err
+		}
+		for _, action := range actions {
+			if re.MatchString(action) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	report := Report{Routes: []RouteCoverage{}, Uncovered: []Route{}, UnusedPatterns: []UnusedPattern{}}
+	used := map[UnusedPattern]bool{}
+
+	for _, route := range routes {
+		rc := RouteCoverage{Route: route}
+
+		if len(route.Requires) > 0 {
+			rc.Permissions = route.Requires
+			rc.Roles = rolesGrantingAll(rules.Roles, route.Requires)
+			report.Routes = append(report.Routes, rc)
+			if !rc.Covered() {
+				report.Uncovered = append(report.Uncovered, route)
+			}
+			continue
+		}
+
+		actions := route.Actions()
+
+		for _, pattern := range rules.Whitelist {
+			ok, err := matchesAny(pattern, actions)
+			if err != nil {
+				return Report{}, err
+			}
+			if ok {
+				rc.Whitelisted = true
+				used[UnusedPattern{Pattern: pattern}] = true
+			}
+		}
+
+		roles := map[string]bool{}
+		for _, permission := range sortedKeys(rules.Permissions) {
+			for _, pattern := range rules.Permissions[permission] {
+				ok, err := matchesAny(pattern, actions)
+				if err != nil {
+					return Report{}, err
+				}
+				if !ok {
+					continue
+				}
+				used[UnusedPattern{Permission: permission, Pattern: pattern}] = true
+				if len(rc.Permissions) == 0 || rc.Permissions[len(rc.Permissions)-1] != permission {
+					rc.Permissions = append(rc.Permissions, permission)
+				}
+				for _, role := range grantedBy[permission] {
+					roles[role] = true
+				}
+			}
+		}
+		rc.Roles = sortedKeys(roles)
+
+		report.Routes = append(report.Routes, rc)
+		if !rc.Covered() {
+			report.Uncovered = append(report.Uncovered, route)
+		}
+	}
+
+	for _, pattern := range rules.Whitelist {
+		if p := (UnusedPattern{Pattern: pattern}); !used[p] {
+			report.UnusedPatterns = append(report.UnusedPatterns, p)
+		}
+	}
+	for _, permission := range sortedKeys(rules.Permissions) {
+		for _, pattern := range rules.Permissions[permission] {
+			if p := (UnusedPattern{Permission: permission, Pattern: pattern}); !used[p] {
+				report.UnusedPatterns = append(report.UnusedPatterns, p)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// rolesGrantingAll devuelve los roles que otorgan todos los permisos.
+func rolesGrantingAll(roles map[string][]string, permissions []string) []string {
+	var result []string
+	for _, role := range sortedKeys(roles) {
+		granted := map[string]bool{}
+		for _, permission := range roles[role] {
+			granted[permission] = true
+		}
+
+		all := true
+		for _, permission := range permissions {
+			all = all && granted[permission]
+		}
+		if all {
+			result = append(result, role)
+		}
+	}
+	return result
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,83 @@
+package coverage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRoute(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    Route
+	}{
+		{pattern: "GET /items/{id}", want: Route{Method: "GET", Path: "/items/{id}"}},
+		{pattern: "/api/", want: Route{Path: "/api/"}},
+		{pattern: "post api.example.com/command", want: Route{Method: "POST", Path: "/command"}},
+	}
+	for _, tt := range tests {
+		if got := ParseRoute(tt.pattern); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseRoute(%q) = %+v, want %+v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestRoute_Actions(t *testing.T) {
+	got := Route{Method: "GET", Path: "/items/{id}/files/{path...}"}.Actions()
+	if want := []string{"GET:/items/1/files/1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Actions() = %v, want %v", got, want)
+	}
+	if got := (Route{Path: "/{$}"}).Actions(); len(got) != len(anyMethod) || got[0] != "GET:/" {
+		t.Errorf("Actions() = %v, want one action per method", got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	rules := Rules{
+		Permissions: map[string][]string{
+			"items.read":     {"GET:/items/[0-9]+$"},
+			"command.create": {"POST:/command$"},
+			"legacy":         {"GET:/old/.*"},
+		},
+		Roles:     map[string][]string{"viewer": {"items.read"}, "admin": {"items.read", "legacy"}},
+		Whitelist: []string{"GET:/health$"},
+	}
+	routes := []Route{
+		ParseRoute("GET /health"),
+		ParseRoute("GET /items/{id}"),
+		ParseRoute("POST /command"),
+		ParseRoute("DELETE /items/{id}"),
+		{Method: "GET", Path: "/reports", Requires: []string{"items.read", "legacy"}},
+		{Method: "GET", Path: "/audit", Requires: []string{"audit.read"}},
+	}
+
+	report, err := Check(routes, rules)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+
+	if !report.Routes[0].Covered() || !report.Routes[0].Whitelisted {
+		t.Errorf("Routes[0] = %+v, want whitelisted", report.Routes[0])
+	}
+	if got := report.Routes[1].Roles; !reflect.DeepEqual(got, []string{"admin", "viewer"}) {
+		t.Errorf("Routes[1].Roles = %v, want [admin viewer]", got)
+	}
+	// command.create coincide pero ningún rol lo otorga.
+	if got := report.Routes[2]; got.Covered() || !reflect.DeepEqual(got.Permissions, []string{"command.create"}) {
+		t.Errorf("Routes[2] = %+v, want permission without roles", got)
+	}
+	// Las rutas con permisos declarados se cubren con los roles que los otorgan todos.
+	if got := report.Routes[4].Roles; !reflect.DeepEqual(got, []string{"admin"}) {
+		t.Errorf("Routes[4].Roles = %v, want [admin]", got)
+	}
+	if want := []Route{routes[2], routes[3], routes[5]}; !reflect.DeepEqual(report.Uncovered, want) {
+		t.Errorf("Uncovered = %v, want %v", report.Uncovered, want)
+	}
+	if want := []UnusedPattern{{Permission: "legacy", Pattern: "GET:/old/.*"}}; !reflect.DeepEqual(report.UnusedPatterns, want) {
+		t.Errorf("UnusedPatterns = %v, want %v", report.UnusedPatterns, want)
+	}
+
+	rules.Whitelist = []string{"GET:/health("}
+	if _, err := Check(routes, rules); err == nil {
+		t.Error("Check() error = nil, want invalid expression")
+	}
+}
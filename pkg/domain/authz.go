@@ -1,6 +1,71 @@
 package domain
 
+import "github.com/google/uuid"
+
 type PolicyInput struct {
 	Payload map[string]any `json:"payload"`
 	Action  string         `json:"action"`
+	Request *RequestInput  `json:"request,omitempty"`
+	// Resource es el documento sobre el que se decide en las comprobaciones a
+	// nivel de objeto (dueño, tenant, estado), ver middleware.ResourceAuthorizer.
+	Resource any `json:"resource,omitempty"`
+	// Requirements son los requisitos que declaró la ruta al registrarse.
+	Requirements *Requirements `json:"requirements,omitempty"`
+}
+
+// Requirements son los requisitos que declara una ruta al registrarse (ver
+// routes.RequirePermissions). Permiten escribir las políticas sobre permisos
+// lógicos, p.ej. "templates.view_all", en lugar de expresiones sobre la URL.
+type Requirements struct {
+	Permissions []string `json:"permissions,omitempty"`
+	Scopes      []string `json:"scopes,omitempty"`
+	Query       string   `json:"query,omitempty"` // consulta que decide la ruta, en lugar de la del middleware
+}
+
+// RequestInput describe la petición HTTP de forma estructurada, para que las
+// políticas no dependan de expresiones regulares sobre la URI completa.
+type RequestInput struct {
+	Method            string              `json:"method"`
+	Path              string              `json:"path"`
+	Segments          []string            `json:"segments"`
+	Pattern           string              `json:"pattern,omitempty"` // patrón del ServeMux, p.ej. "GET /items/{id}"
+	PathValues        map[string]string   `json:"pathValues,omitempty"`
+	Query             map[string][]string `json:"query,omitempty"`
+	Headers           map[string]string   `json:"headers,omitempty"` // solo las cabeceras permitidas por configuración
+	RemoteIP          string              `json:"remoteIp,omitempty"`
+	ClientCertSubject string              `json:"clientCertSubject,omitempty"` // certificado de cliente verificado
+}
+
+// Decision es el resultado completo de evaluar una política.
+type Decision struct {
+	ID          string      `json:"decisionId,omitempty"`
+	Allow       bool        `json:"allow"`
+	Reasons     []string    `json:"reasons,omitempty"` // por qué se permitió o denegó, según la política
+	Obligations Obligations `json:"obligations,omitempty"`
+	Revision    string      `json:"revision,omitempty"` // versión de las políticas que tomó la decisión
+
+	// Explanation solo se informa si se pidió con port.WithExplain y el motor
+	// tiene el modo explicación habilitado.
+	Explanation *Explanation `json:"explanation,omitempty"`
+}
+
+// NewDecisionID genera un identificador ordenable en el tiempo (UUIDv7) para
+// una decisión.
+func NewDecisionID() string {
+	if id, err := uuid.NewV7(); err == nil {
+		return id.String()
+	}
+	return uuid.NewString()
+}
+
+// Explanation permite reproducir una decisión sin volver a ejecutar opa eval:
+// la traza de la evaluación y el input exacto que recibió la política.
+type Explanation struct {
+	Trace []string    `json:"trace"`
+	Input PolicyInput `json:"input"`
+}
+
+// Obligations son acciones que la política exige aplicar junto con la decisión.
+type Obligations struct {
+	Headers map[string]string `json:"headers,omitempty"` // cabeceras a agregar a la respuesta
 }
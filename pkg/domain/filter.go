@@ -0,0 +1,34 @@
+package domain
+
+// FilterOp es el operador de un nodo del filtro.
+type FilterOp string
+
+const (
+	FilterTrue  FilterOp = "true"  // sin restricciones: el principal puede ver todo
+	FilterFalse FilterOp = "false" // ningún recurso está permitido
+	FilterAnd   FilterOp = "and"
+	FilterOr    FilterOp = "or"
+	FilterNot   FilterOp = "not"
+	FilterEq    FilterOp = "eq"
+	FilterNe    FilterOp = "ne"
+	FilterLt    FilterOp = "lt"
+	FilterLte   FilterOp = "lte"
+	FilterGt    FilterOp = "gt"
+	FilterGte   FilterOp = "gte"
+	FilterIn    FilterOp = "in" // Value es una lista
+)
+
+// Filter es la condición que deben cumplir los recursos para que la política
+// los permita, obtenida por evaluación parcial. Field es la ruta del campo
+// dentro de input.resource, con puntos para campos anidados ("owner", "meta.tenant").
+//
+//	{"op": "or", "args": [
+//	  {"op": "eq", "field": "owner", "value": "user-1"},
+//	  {"op": "eq", "field": "public", "value": true}
+//	]}
+type Filter struct {
+	Op    FilterOp `json:"op"`
+	Field string   `json:"field,omitempty"`
+	Value any      `json:"value"`          // sin omitempty: false y 0 son valores válidos
+	Args  []Filter `json:"args,omitempty"` // operandos de and, or y not
+}
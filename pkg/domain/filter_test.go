@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestFilter_JSONKeepsFalsyValues(t *testing.T) {
+	filter := Filter{Op: FilterAnd, Args: []Filter{
+		{Op: FilterEq, Field: "archived", Value: false},
+		{Op: FilterEq, Field: "level", Value: float64(0)},
+		{Op: FilterEq, Field: "owner", Value: ""},
+	}}
+
+	raw, err := json.Marshal(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Filter
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, filter) {
+		t.Errorf("round trip = %+v, want %+v (json %s)", got, filter, raw)
+	}
+}
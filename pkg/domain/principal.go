@@ -0,0 +1,50 @@
+package domain
+
+import "slices"
+
+// Principal es la identidad autenticada de la petición, construida a partir
+// del payload que entregó el extractor.
+type Principal struct {
+	Subject    string         `json:"sub,omitempty"`
+	Roles      []string       `json:"roles"`
+	Scopes     []string       `json:"scopes"`
+	AuthScheme string         `json:"authScheme,omitempty"`
+	Claims     map[string]any `json:"claims,omitempty"` // payload completo, tal como lo recibe la política
+}
+
+// NewPrincipal interpreta los campos convencionales del payload: sub, roles,
+// scopes y authScheme. El payload completo queda disponible en Claims.
+func NewPrincipal(payload map[string]any) Principal {
+	p := Principal{
+		Roles:  stringsOf(payload["roles"]),
+		Scopes: stringsOf(payload["scopes"]),
+		Claims: payload,
+	}
+	p.Subject, _ = payload["sub"].(string)
+	p.AuthScheme, _ = payload["authScheme"].(string)
+	return p
+}
+
+func (p Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+func stringsOf(v any) []string {
+	switch list := v.(type) {
+	case []string:
+		return list
+	case []any:
+		out := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return []string{}
+}
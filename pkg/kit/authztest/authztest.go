@@ -0,0 +1,256 @@
+// Package authztest comprueba las políticas contra las rutas HTTP reales: cada
+// caso pasa por AuthorizationMiddleware con httptest, así se verifica también
+// que las acciones que arma el middleware coinciden con las expresiones de
+// permissions.json, algo que los tests de rego no cubren.
+//
+//	func TestPolicies(t *testing.T) {
+//		h, err := authztest.New(context.Background(), opa.Config{
+//			Query:        "data.authz.decision",
+//			FS:           policies.Authz,
+//			PoliciesPath: "authz",
+//		})
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		h.RunFile(t, "testdata/routes.yaml")
+//	}
+package authztest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/norlis/httpgate/pkg/adapter/apidriven/middleware"
+	"github.com/norlis/httpgate/pkg/adapter/opa"
+	"github.com/norlis/httpgate/pkg/domain"
+	"github.com/norlis/httpgate/pkg/port"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// Case es una petición y la decisión esperada.
+type Case struct {
+	Name    string            `yaml:"name"`
+	Method  string            `yaml:"method"` // GET por defecto
+	URL     string            `yaml:"url"`    // ruta con query, p.ej. /api/items/42?v=1
+	Headers map[string]string `yaml:"headers"`
+	Payload map[string]any    `yaml:"payload"` // lo que devolvería el extractor de credenciales
+	Allow   bool              `yaml:"allow"`
+}
+
+func (c Case) String() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.method() + " " + c.URL
+}
+
+func (c Case) method() string {
+	if c.Method == "" {
+		return http.MethodGet
+	}
+	return strings.ToUpper(c.Method)
+}
+
+// Result es lo que ocurrió con un caso.
+type Result struct {
+	Case     Case
+	Allowed  bool               // la petición llegó al handler
+	Status   int                // código de la respuesta
+	Input    domain.PolicyInput // input que recibió la política
+	Decision domain.Decision
+	Err      error // error del motor de políticas
+}
+
+// Passed indica si la decisión coincide con la esperada.
+func (r Result) Passed() bool {
+	return r.Err == nil && r.Allowed == r.Case.Allow
+}
+
+// String describe el resultado con el detalle de la decisión, para reportar
+// las diferencias.
+func (r Result) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: allow = %v, want %v (status %d)", r.Case, r.Allowed, r.Case.Allow, r.Status)
+	if r.Err != nil {
+		fmt.Fprintf(&b, "\n  error: %v", r.Err)
+	}
+	fmt.Fprintf(&b, "\n  action: %s", r.Input.Action)
+	if r.Decision.ID != "" {
+		fmt.Fprintf(&b, "\n  decision: %s (revision %s)", r.Decision.ID, r.Decision.Revision)
+	}
+	for _, reason := range r.Decision.Reasons {
+		fmt.Fprintf(&b, "\n  reason: %s", reason)
+	}
+	if e := r.Decision.Explanation; e != nil {
+		for _, line := range e.Trace {
+			fmt.Fprintf(&b, "\n  | %s", line)
+		}
+	}
+	return b.String()
+}
+
+// Harness ejecuta los casos contra un enforcer.
+type Harness struct {
+	enforcer port.PolicyEnforcer
+	options  []middleware.AuthzOption
+	mux      *http.ServeMux
+}
+
+// Option configura el Harness.
+type Option func(*Harness)
+
+// WithAuthzOptions pasa opciones a AuthorizationMiddleware, p.ej. WithQuery o
+// WithInputHeaders, para probar la misma configuración que usa el servicio.
+func WithAuthzOptions(opts ...middleware.AuthzOption) Option {
+	return func(h *Harness) {
+		h.options = append(h.options, opts...)
+	}
+}
+
+// WithRoutes resuelve las peticiones con el ServeMux del servicio, así
+// input.request.pattern y pathValues son los mismos que en producción.
+func WithRoutes(mux *http.ServeMux) Option {
+	return func(h *Harness) {
+		h.mux = mux
+	}
+}
+
+// New carga las políticas de cfg. Si cfg no define un modo de explicación se
+// usa opa.ExplainFails, para que las diferencias muestren las reglas que fallaron.
+func New(ctx context.Context, cfg opa.Config, opts ...Option) (*Harness, error) {
+	if cfg.Explain == opa.ExplainOff {
+		cfg.Explain = opa.ExplainFails
+	}
+	cfg.Watch = false
+
+	client, err := opa.NewOpaSdkClientFromConfig(ctx, cfg, zap.NewNop())
+	if err != nil {
+		return nil, err
+	}
+	return NewWithEnforcer(client, opts...), nil
+}
+
+// NewWithEnforcer ejecuta los casos contra un enforcer ya construido.
+func NewWithEnforcer(enforcer port.PolicyEnforcer, opts ...Option) *Harness {
+	h := &Harness{enforcer: enforcer}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Run ejecuta los casos en orden.
+func (h *Harness) Run(cases []Case) []Result {
+	results := make([]Result, 0, len(cases))
+	for _, c := range cases {
+		results = append(results, h.run(c))
+	}
+	return results
+}
+
+func (h *Harness) run(c Case) Result {
+	rec := &recorder{next: h.enforcer}
+	result := Result{Case: c}
+
+	extractor := func(*http.Request) (map[string]any, error) {
+		if c.Payload == nil {
+			return map[string]any{}, nil
+		}
+		return c.Payload, nil
+	}
+
+	opts := append([]middleware.AuthzOption{}, h.options...)
+	if h.mux != nil {
+		opts = append(opts, middleware.WithRouteResolver(h.mux))
+	}
+
+	handler := middleware.AuthorizationMiddleware(rec, extractor, opts...)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		result.Allowed = true
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(c.method(), c.URL, nil)
+	for name, value := range c.Headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	result.Status = w.Code
+	result.Input, result.Decision, result.Err = rec.input, rec.decision, rec.err
+	return result
+}
+
+// RunT ejecuta cada caso como un subtest y reporta las diferencias.
+func (h *Harness) RunT(t *testing.T, cases []Case) {
+	t.Helper()
+	for _, c := range cases {
+		t.Run(c.String(), func(t *testing.T) {
+			if r := h.run(c); !r.Passed() {
+				t.Error(r)
+			}
+		})
+	}
+}
+
+// RunFile carga los casos de un YAML (ver LoadCases) y los ejecuta con RunT.
+func (h *Harness) RunFile(t *testing.T, path string) {
+	t.Helper()
+	cases, err := LoadCases(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.RunT(t, cases)
+}
+
+// LoadCases lee una lista de casos en YAML con los campos de Case (ver
+// policies/README.md), p.ej.
+//
+//	[{name: status, url: /status, allow: true}, {method: DELETE, url: /api/items/42, payload: {roles: [viewer]}}]
+func LoadCases(path string) ([]Case, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cases []Case
+	if err := yaml.Unmarshal(raw, &cases); err != nil {
+		return nil, fmt.Errorf("error al leer los casos de %s: %w", path, err)
+	}
+	for i, c := range cases {
+		if c.URL == "" {
+			return nil, fmt.Errorf("el caso %d de %s no tiene url", i+1, path)
+		}
+	}
+	return cases, nil
+}
+
+// recorder guarda el input y la decisión que tomó el enforcer y pide su explicación.
+type recorder struct {
+	next     port.PolicyEnforcer
+	input    domain.PolicyInput
+	decision domain.Decision
+	err      error
+}
+
+func (r *recorder) IsAllowed(ctx context.Context, input domain.PolicyInput) (bool, error) {
+	decision, err := r.Decide(ctx, input)
+	return decision.Allow, err
+}
+
+func (r *recorder) Decide(ctx context.Context, input domain.PolicyInput) (domain.Decision, error) {
+	return r.DecideQuery(ctx, "", input)
+}
+
+func (r *recorder) DecideQuery(ctx context.Context, query string, input domain.PolicyInput) (domain.Decision, error) {
+	r.input = input
+	r.decision, r.err = port.DecideQuery(port.WithExplain(ctx), r.next, query, input)
+	return r.decision, r.err
+}
@@ -0,0 +1,90 @@
+package authztest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/norlis/httpgate/pkg/adapter/apidriven/middleware"
+	"github.com/norlis/httpgate/pkg/adapter/apidriven/routes"
+	"github.com/norlis/httpgate/pkg/adapter/opa"
+	"github.com/norlis/httpgate/policies"
+)
+
+func newHarness(t *testing.T) *Harness {
+	t.Helper()
+	h, err := New(context.Background(), opa.Config{
+		Query:        "data.authz.decision",
+		FS:           policies.Authz,
+		PoliciesPath: "authz",
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return h
+}
+
+func TestHarness_RunFile(t *testing.T) {
+	newHarness(t).RunFile(t, "testdata/routes.yaml")
+}
+
+func TestHarness_ReportsMismatch(t *testing.T) {
+	results := newHarness(t).Run([]Case{
+		{Method: "delete", URL: "/api/items/42?force=true", Allow: true},
+	})
+
+	r := results[0]
+	if r.Passed() {
+		t.Fatal("Passed() = true, want a mismatch")
+	}
+	if r.Input.Action != "DELETE:/api/items/42?force=true" {
+		t.Errorf("Input.Action = %q, want DELETE:/api/items/42?force=true", r.Input.Action)
+	}
+
+	report := r.String()
+	for _, want := range []string{"DELETE /api/items/42?force=true: allow = false, want true", "no permission grants", "| "} {
+		if !strings.Contains(report, want) {
+			t.Errorf("String() = %s, want it to contain %q", report, want)
+		}
+	}
+}
+
+func TestHarness_RouteRequirements(t *testing.T) {
+	registry := routes.NewRegistry(nil)
+	api := registry.Group("/api")
+	api.HandleFunc("GET /status", func(http.ResponseWriter, *http.Request) {}, routes.RequirePermissions("whitelist"))
+	api.HandleFunc("POST /commands", func(http.ResponseWriter, *http.Request) {}, routes.RequirePermissions("command.create"))
+	api.HandleFunc("DELETE /commands/{id}", func(http.ResponseWriter, *http.Request) {}, routes.RequirePermissions("super-admin"))
+
+	h, err := New(context.Background(), opa.Config{
+		Query:        "data.authz.decision",
+		FS:           policies.Authz,
+		PoliciesPath: "authz",
+	}, WithAuthzOptions(middleware.WithRequirements(registry)))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	h.RunT(t, []Case{
+		{Name: "anonymous has the whitelist permission", URL: "/api/status", Allow: true},
+		{Name: "commands require command.create", Method: "POST", URL: "/api/commands", Allow: false},
+		{Name: "admin is granted super-admin", Method: "DELETE", URL: "/api/commands/7", Payload: map[string]any{"roles": []any{"admin"}}, Allow: true},
+		{Name: "viewer is not granted super-admin", Method: "DELETE", URL: "/api/commands/7", Payload: map[string]any{"roles": []any{"viewer"}}, Allow: false},
+	})
+
+	r := h.Run([]Case{{Method: "POST", URL: "/api/commands"}})[0]
+	if r.Input.Request.Pattern != "POST /api/commands" || !strings.Contains(r.String(), "missing permission command.create") {
+		t.Errorf("Run() = %s (pattern %q)", r, r.Input.Request.Pattern)
+	}
+}
+
+func TestLoadCases(t *testing.T) {
+	cases, err := LoadCases("testdata/routes.yaml")
+	if err != nil {
+		t.Fatalf("LoadCases() error = %v", err)
+	}
+	if len(cases) != 8 || cases[4].method() != "POST" || !cases[4].Allow {
+		t.Errorf("LoadCases() = %+v", cases)
+	}
+}
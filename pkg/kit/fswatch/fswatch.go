@@ -0,0 +1,129 @@
+// Package fswatch observa archivos y directorios y avisa cuando algo cambia,
+// agrupando las ráfagas de eventos en un solo aviso.
+package fswatch
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// debounce agrupa las ráfagas de eventos que generan los editores y los
+// montajes de ConfigMaps y Secrets en un solo aviso.
+const debounce = 200 * time.Millisecond
+
+// Watcher invoca onChange ante cualquier cambio en los directorios observados.
+// No filtra por nombre de archivo: Kubernetes actualiza los volúmenes
+// reemplazando el enlace simbólico ..data, y el archivo montado nunca recibe
+// un evento propio.
+type Watcher struct {
+	fsw      *fsnotify.Watcher
+	done     chan struct{}
+	once     sync.Once
+	onChange func()
+	logger   *zap.Logger
+}
+
+// New observa los directorios indicados (y sus subdirectorios) y, para los
+// archivos sueltos, su directorio padre, de modo que también se detectan los
+// reemplazos atómicos (rename).
+func New(paths []string, logger *zap.Logger, onChange func()) (*Watcher, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range Dirs(paths) {
+		if err := fsw.Add(dir); err != nil {
+			_ = fsw.Close()
+			return nil, err
+		}
+	}
+
+	w := &Watcher{
+		fsw:      fsw,
+		done:     make(chan struct{}),
+		onChange: onChange,
+		logger:   logger,
+	}
+	go w.run()
+
+	return w, nil
+}
+
+func (w *Watcher) run() {
+	var timer *time.Timer
+	for {
+		select {
+		case <-w.done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Chmod) {
+				continue
+			}
+			w.logger.Debug("cambio detectado", zap.String("file", event.Name))
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.AfterFunc(debounce, w.onChange)
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Warn("error al observar los archivos", zap.Error(err))
+		}
+	}
+}
+
+// Close deja de observar los directorios.
+func (w *Watcher) Close() error {
+	var err error
+	w.once.Do(func() {
+		close(w.done)
+		err = w.fsw.Close()
+	})
+	return err
+}
+
+// Dirs devuelve los directorios a observar: cada directorio indicado con sus
+// subdirectorios y, para los archivos sueltos, su directorio padre.
+func Dirs(paths []string) []string {
+	seen := make(map[string]struct{})
+	var dirs []string
+	add := func(dir string) {
+		if _, ok := seen[dir]; !ok {
+			seen[dir] = struct{}{}
+			dirs = append(dirs, dir)
+		}
+	}
+
+	for _, path := range paths {
+		_ = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				add(p)
+			} else if p == path {
+				add(filepath.Dir(p))
+			}
+			return nil
+		})
+	}
+
+	return dirs
+}
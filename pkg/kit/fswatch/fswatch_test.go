@@ -0,0 +1,80 @@
+package fswatch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDirs(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	other := t.TempDir()
+	file := filepath.Join(other, "data.json")
+	if err := os.WriteFile(file, []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got := Dirs([]string{root, file, filepath.Join(root, "missing")})
+	want := []string{root, sub, other}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Dirs() = %v, want %v", got, want)
+	}
+}
+
+// mountSecret reproduce cómo Kubernetes publica un Secret: el archivo es un
+// enlace a ..data/<nombre> y ..data apunta al directorio con la versión vigente.
+func mountSecret(t *testing.T, dir, version, content string) {
+	t.Helper()
+	versionDir := filepath.Join(dir, version)
+	if err := os.Mkdir(versionDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(versionDir, "keys.yaml"), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tmp := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(version, tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcher_SecretSymlinkSwap(t *testing.T) {
+	dir := t.TempDir()
+	mountSecret(t, dir, "..v1", "first")
+	path := filepath.Join(dir, "keys.yaml")
+	if err := os.Symlink(filepath.Join("..data", "keys.yaml"), path); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := make(chan struct{}, 1)
+	w, err := New([]string{path}, nil, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	mountSecret(t, dir, "..v2", "second")
+
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("onChange not called after the ..data swap")
+	}
+	if raw, _ := os.ReadFile(path); string(raw) != "second" {
+		t.Errorf("content = %q, want second", raw)
+	}
+}
@@ -34,8 +34,13 @@ type ProblemDetail struct {
 
 type Extension struct {
 	RequestId  string    `json:"requestId,omitempty"`
+	DecisionId string    `json:"decisionId,omitempty"`
 	Timestamp  time.Time `json:"timestamp"`
 	StackTrace string    `json:"stackTrace,omitempty"`
+
+	// Explanation detalla cómo se tomó una decisión de autorización; solo se
+	// incluye en modo explicación, nunca en producción.
+	Explanation any `json:"explanation,omitempty"`
 }
 
 func (p *ProblemDetail) Error() string {
@@ -81,6 +86,21 @@ func WithDetail(detail string) Option {
 	}
 }
 
+// WithDecision asocia el problema a la decisión de autorización que lo originó,
+// para poder cruzarlo con los registros de auditoría.
+func WithDecision(id string) Option {
+	return func(p *ProblemDetail) {
+		p.DecisionId = id
+	}
+}
+
+// WithExplanation adjunta la explicación de la decisión de autorización.
+func WithExplanation(explanation any) Option {
+	return func(p *ProblemDetail) {
+		p.Explanation = explanation
+	}
+}
+
 // WithInstance asigna el URI de la petición actual como la instancia del problema.
 func WithInstance(r *http.Request) Option {
 	return func(p *ProblemDetail) {
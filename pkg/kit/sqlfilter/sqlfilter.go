@@ -0,0 +1,135 @@
+// Package sqlfilter traduce un domain.Filter (obtenido por evaluación parcial
+// de la política) a un fragmento WHERE parametrizado.
+package sqlfilter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/norlis/httpgate/pkg/domain"
+)
+
+// Placeholder genera el marcador del parámetro n (desde 1).
+type Placeholder func(n int) string
+
+var (
+	// Question genera "?", para MySQL y SQLite.
+	Question Placeholder = func(int) string { return "?" }
+	// Dollar genera "$1", "$2"..., para PostgreSQL.
+	Dollar Placeholder = func(n int) string { return "$" + strconv.Itoa(n) }
+)
+
+var operators = map[domain.FilterOp]string{
+	domain.FilterEq:  "=",
+	domain.FilterNe:  "<>",
+	domain.FilterLt:  "<",
+	domain.FilterLte: "<=",
+	domain.FilterGt:  ">",
+	domain.FilterGte: ">=",
+}
+
+// Where devuelve la condición y sus argumentos. columns indica la columna de
+// cada campo del filtro; un campo sin columna es un error, así ningún nombre
+// que venga de la política llega al SQL sin pasar por esa lista.
+//
+//	where, args, err := sqlfilter.Where(filter, map[string]string{"owner": "d.owner_id"}, sqlfilter.Dollar)
+//	rows, err := db.QueryContext(ctx, "SELECT * FROM documents d WHERE "+where, args...)
+func Where(f domain.Filter, columns map[string]string, placeholder Placeholder) (string, []any, error) {
+	if placeholder == nil {
+		placeholder = Question
+	}
+	b := &builder{columns: columns, placeholder: placeholder}
+	if err := b.write(f); err != nil {
+		return "", nil, err
+	}
+	return b.sql.String(), b.args, nil
+}
+
+type builder struct {
+	sql         strings.Builder
+	args        []any
+	columns     map[string]string
+	placeholder Placeholder
+}
+
+func (b *builder) arg(v any) string {
+	b.args = append(b.args, v)
+	return b.placeholder(len(b.args))
+}
+
+func (b *builder) write(f domain.Filter) error {
+	switch f.Op {
+	case domain.FilterTrue:
+		b.sql.WriteString("1 = 1")
+		return nil
+	case domain.FilterFalse:
+		b.sql.WriteString("1 = 0")
+		return nil
+	case domain.FilterAnd, domain.FilterOr:
+		sep := " AND "
+		if f.Op == domain.FilterOr {
+			sep = " OR "
+		}
+		b.sql.WriteString("(")
+		for i, arg := range f.Args {
+			if i > 0 {
+				b.sql.WriteString(sep)
+			}
+			if err := b.write(arg); err != nil {
+				return err
+			}
+		}
+		b.sql.WriteString(")")
+		return nil
+	case domain.FilterNot:
+		if len(f.Args) != 1 {
+			return fmt.Errorf("not requiere un operando, tiene %d", len(f.Args))
+		}
+		b.sql.WriteString("NOT (")
+		if err := b.write(f.Args[0]); err != nil {
+			return err
+		}
+		b.sql.WriteString(")")
+		return nil
+	}
+
+	column, ok := b.columns[f.Field]
+	if !ok {
+		return fmt.Errorf("el campo %q no tiene columna asignada", f.Field)
+	}
+
+	if f.Op == domain.FilterIn {
+		values, ok := f.Value.([]any)
+		if !ok {
+			return fmt.Errorf("in requiere una lista para %q", f.Field)
+		}
+		if len(values) == 0 {
+			b.sql.WriteString("1 = 0")
+			return nil
+		}
+		marks := make([]string, len(values))
+		for i, v := range values {
+			marks[i] = b.arg(v)
+		}
+		fmt.Fprintf(&b.sql, "%s IN (%s)", column, strings.Join(marks, ", "))
+		return nil
+	}
+
+	op, ok := operators[f.Op]
+	if !ok {
+		return fmt.Errorf("operador de filtro no soportado: %s", f.Op)
+	}
+	if f.Value == nil {
+		if f.Op == domain.FilterEq {
+			fmt.Fprintf(&b.sql, "%s IS NULL", column)
+			return nil
+		}
+		if f.Op == domain.FilterNe {
+			fmt.Fprintf(&b.sql, "%s IS NOT NULL", column)
+			return nil
+		}
+	}
+	fmt.Fprintf(&b.sql, "%s %s %s", column, op, b.arg(f.Value))
+	return nil
+}
@@ -0,0 +1,55 @@
+package sqlfilter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/norlis/httpgate/pkg/domain"
+)
+
+func TestWhere(t *testing.T) {
+	columns := map[string]string{"owner": "d.owner_id", "status": "d.status", "meta.level": "d.level", "archived": "d.archived"}
+
+	tests := []struct {
+		name        string
+		filter      domain.Filter
+		placeholder Placeholder
+		want        string
+		wantArgs    []any
+		wantErr     bool
+	}{
+		{name: "true", filter: domain.Filter{Op: domain.FilterTrue}, want: "1 = 1"},
+		{name: "false", filter: domain.Filter{Op: domain.FilterFalse}, want: "1 = 0"},
+		{
+			name: "or of and",
+			filter: domain.Filter{Op: domain.FilterOr, Args: []domain.Filter{
+				{Op: domain.FilterEq, Field: "owner", Value: "u1"},
+				{Op: domain.FilterAnd, Args: []domain.Filter{
+					{Op: domain.FilterIn, Field: "status", Value: []any{"draft", "review"}},
+					{Op: domain.FilterNot, Args: []domain.Filter{{Op: domain.FilterEq, Field: "archived", Value: true}}},
+					{Op: domain.FilterLt, Field: "meta.level", Value: 3},
+				}},
+			}},
+			placeholder: Dollar,
+			want:        "(d.owner_id = $1 OR (d.status IN ($2, $3) AND NOT (d.archived = $4) AND d.level < $5))",
+			wantArgs:    []any{"u1", "draft", "review", true, 3},
+		},
+		{name: "null", filter: domain.Filter{Op: domain.FilterEq, Field: "owner"}, want: "d.owner_id IS NULL"},
+		{name: "unknown field", filter: domain.Filter{Op: domain.FilterEq, Field: "password", Value: "x"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, args, err := Where(tt.filter, columns, tt.placeholder)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Where() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Where() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
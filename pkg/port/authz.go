@@ -2,6 +2,7 @@ package port
 
 import (
 	"context"
+	"errors"
 
 	"github.com/norlis/httpgate/pkg/domain"
 )
@@ -11,3 +12,116 @@ import (
 type PolicyEnforcer interface {
 	IsAllowed(ctx context.Context, input domain.PolicyInput) (bool, error)
 }
+
+// DecisionMaker es un PolicyEnforcer capaz de devolver la decisión completa
+// (motivos, obligaciones, revisión) en lugar de un booleano.
+type DecisionMaker interface {
+	PolicyEnforcer
+	Decide(ctx context.Context, input domain.PolicyInput) (domain.Decision, error)
+}
+
+// QueryDecider es un motor capaz de evaluar consultas distintas de la
+// configurada por defecto, p.ej. "data.documents.allow" para decidir sobre un
+// recurso concreto desde un handler.
+type QueryDecider interface {
+	DecideQuery(ctx context.Context, query string, input domain.PolicyInput) (domain.Decision, error)
+}
+
+// ErrQueryNotSupported indica que el enforcer solo evalúa su consulta por defecto.
+var ErrQueryNotSupported = errors.New("el motor de políticas no admite consultas con nombre")
+
+// Decide evalúa el input con el enforcer. Si el enforcer no implementa
+// DecisionMaker, la decisión se construye a partir de IsAllowed.
+func Decide(ctx context.Context, enforcer PolicyEnforcer, input domain.PolicyInput) (domain.Decision, error) {
+	if dm, ok := enforcer.(DecisionMaker); ok {
+		return dm.Decide(ctx, input)
+	}
+
+	allowed, err := enforcer.IsAllowed(ctx, input)
+	if err != nil {
+		return domain.Decision{}, err
+	}
+	return domain.Decision{Allow: allowed}, nil
+}
+
+// DecideQuery evalúa el input con la consulta indicada. Si query está vacía se
+// usa la consulta por defecto del enforcer.
+func DecideQuery(ctx context.Context, enforcer PolicyEnforcer, query string, input domain.PolicyInput) (domain.Decision, error) {
+	if query == "" {
+		return Decide(ctx, enforcer, input)
+	}
+	if qd, ok := enforcer.(QueryDecider); ok {
+		return qd.DecideQuery(ctx, query, input)
+	}
+	return domain.Decision{}, ErrQueryNotSupported
+}
+
+// Revisioner lo implementan los enforcers que pueden recargar sus políticas;
+// la revisión cambia con cada recarga. Los decoradores la propagan para que
+// una caché por encima de ellos sepa cuándo invalidar.
+type Revisioner interface {
+	Revision() string
+}
+
+// Revision devuelve la revisión de políticas del enforcer, o "" si no la informa.
+func Revision(enforcer PolicyEnforcer) string {
+	if r, ok := enforcer.(Revisioner); ok {
+		return r.Revision()
+	}
+	return ""
+}
+
+// Filterer traduce una consulta en un filtro sobre los recursos (evaluación
+// parcial con input.resource como desconocido), para listados que no pueden
+// evaluar la política recurso por recurso.
+type Filterer interface {
+	Filter(ctx context.Context, query string, input domain.PolicyInput) (domain.Filter, error)
+}
+
+// BatchDecider evalúa varios inputs en una sola llamada, con la misma revisión de políticas.
+type BatchDecider interface {
+	DecideBatch(ctx context.Context, inputs []domain.PolicyInput) ([]domain.Decision, error)
+}
+
+// ErrFilterNotSupported indica que el enforcer no admite evaluación parcial.
+var ErrFilterNotSupported = errors.New("el motor de políticas no admite evaluación parcial")
+
+// Filter obtiene el filtro de la consulta si el enforcer implementa Filterer.
+func Filter(ctx context.Context, enforcer PolicyEnforcer, query string, input domain.PolicyInput) (domain.Filter, error) {
+	if f, ok := enforcer.(Filterer); ok {
+		return f.Filter(ctx, query, input)
+	}
+	return domain.Filter{}, ErrFilterNotSupported
+}
+
+// DecideBatch evalúa todos los inputs. Si el enforcer no implementa
+// BatchDecider se evalúan de a uno con Decide.
+func DecideBatch(ctx context.Context, enforcer PolicyEnforcer, inputs []domain.PolicyInput) ([]domain.Decision, error) {
+	if bd, ok := enforcer.(BatchDecider); ok {
+		return bd.DecideBatch(ctx, inputs)
+	}
+
+	decisions := make([]domain.Decision, len(inputs))
+	for i, input := range inputs {
+		decision, err := Decide(ctx, enforcer, input)
+		if err != nil {
+			return nil, err
+		}
+		decisions[i] = decision
+	}
+	return decisions, nil
+}
+
+// IsAllowedBatch es el atajo de DecideBatch que solo devuelve si cada input se permite.
+func IsAllowedBatch(ctx context.Context, enforcer PolicyEnforcer, inputs []domain.PolicyInput) ([]bool, error) {
+	decisions, err := DecideBatch(ctx, enforcer, inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make([]bool, len(decisions))
+	for i, decision := range decisions {
+		allowed[i] = decision.Allow
+	}
+	return allowed, nil
+}
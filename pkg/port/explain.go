@@ -0,0 +1,18 @@
+package port
+
+import "context"
+
+type explainKey struct{}
+
+// WithExplain pide al motor de políticas que adjunte la explicación de las
+// decisiones que se tomen con este contexto (domain.Decision.Explanation).
+// El motor solo lo hace si además tiene el modo explicación habilitado.
+func WithExplain(ctx context.Context) context.Context {
+	return context.WithValue(ctx, explainKey{}, true)
+}
+
+// ExplainRequested indica si el contexto pide explicar las decisiones.
+func ExplainRequested(ctx context.Context) bool {
+	v, _ := ctx.Value(explainKey{}).(bool)
+	return v
+}
@@ -4,6 +4,7 @@
 package authz
 
 import future.keywords.in
+import future.keywords.every
 import future.keywords.if
 
 default allow := false
@@ -13,22 +14,76 @@ default action_allowed := false
 default roles := {"anonymous"}
 
 roles := input.payload.roles if {
-	count(input.roles) > 0
+	count(input.payload.roles) > 0
 }
 
 # whitelist
 allow if {
+	not has_requirements
 	some action in data.whitelist
 	regex.match(action, input.action)
 }
 
 allow if {
+	not has_requirements
 	action_allowed
 }
 
+# requirements: la ruta declaró permisos lógicos y scopes al registrarse
+# (routes.RequirePermissions, routes.RequireScopes); se decide solo con ellos.
+has_requirements if count(object.get(input, "requirements", {})) > 0
+
+allow if {
+	has_requirements
+	every permission in object.get(input.requirements, "permissions", []) {
+		permission_granted(permission)
+	}
+	every scope in object.get(input.requirements, "scopes", []) {
+		scope in object.get(input.payload, "scopes", [])
+	}
+}
+
+permission_granted(permission) if {
+	some role in roles
+	permission in data.roles[role]
+}
+
 action_allowed if {
 	some role in roles
 	some permission in data.roles[role]
 	some path in data.permissions[permission]
 	regex.match(path, input.action)
 }
+
+# decision agrupa el resultado con sus motivos, para consultarlo con Decide
+decision := {
+	"allow": allow,
+	"reasons": reasons,
+}
+
+reasons contains sprintf("whitelist %s", [action]) if {
+	some action in data.whitelist
+	regex.match(action, input.action)
+}
+
+reasons contains sprintf("role %s grants %s", [role, permission]) if {
+	some role in roles
+	some permission in data.roles[role]
+	some path in data.permissions[permission]
+	regex.match(path, input.action)
+}
+
+reasons contains sprintf("missing permission %s", [permission]) if {
+	some permission in input.requirements.permissions
+	not permission_granted(permission)
+}
+
+reasons contains sprintf("missing scope %s", [scope]) if {
+	some scope in input.requirements.scopes
+	not scope in object.get(input.payload, "scopes", [])
+}
+
+reasons contains sprintf("no permission grants %s", [input.action]) if {
+	not has_requirements
+	not allow
+}
@@ -7,20 +7,51 @@ test_ok := true
 
 test_allow_whitelist if {
 	authz.allow
-		with input as { "roles": [], "action": "GET:/health" }
+		with input as {"payload": {"roles": []}, "action": "GET:/health"}
 		with data.whitelist as ["GET:/health$"]
 }
 
 test_allow_viewer if {
 	authz.allow
-		with input as {"roles": ["viewer"], "action": "GET:/api/box"}
+		with input as {"payload": {"roles": ["viewer"]}, "action": "GET:/api/box"}
 		with data.roles as {"viewer": ["templates.view_all"]}
 		with data.permissions as {"templates.view_all": [ "GET:/api/box$"]}
 }
 
 test_allow_viewer_deny if {
 	not authz.allow
-		with input as {"roles": ["viewer"], "action": "GET:/api/entry/key?v=production/proxy"}
+		with input as {"payload": {"roles": ["viewer"]}, "action": "GET:/api/entry/key?v=production/proxy"}
 		with data.roles as {"viewer": ["templates.view_development_qa_global"]}
 		with data.permissions as {"templates.view_development_qa_global": [ "^GET:/api/entry/key\\?v=(development|qa|global)/(.*)"]}
 }
+
+test_decision_deny_reason if {
+	d := authz.decision
+		with input as {"payload": {"roles": []}, "action": "POST:/command"}
+		with data.whitelist as []
+		with data.roles as {"anonymous": []}
+	not d.allow
+	"no permission grants POST:/command" in d.reasons
+}
+
+test_allow_requirements if {
+	authz.allow
+		with input as {"action": "GET:/api/templates", "payload": {"roles": ["viewer"], "scopes": ["read"]}, "requirements": {"permissions": ["templates.view_all"], "scopes": ["read"]}}
+		with data.roles as {"viewer": ["templates.view_all"]}
+}
+
+test_requirements_deny_reasons if {
+	d := authz.decision
+		with input as {"action": "GET:/api/templates", "payload": {"roles": ["viewer"]}, "requirements": {"permissions": ["templates.view_all"], "scopes": ["read"]}}
+		with data.roles as {"viewer": []}
+	not d.allow
+	"missing permission templates.view_all" in d.reasons
+	"missing scope read" in d.reasons
+}
+
+test_requirements_ignore_whitelist if {
+	not authz.allow
+		with input as {"action": "GET:/health", "requirements": {"permissions": ["health.read"]}}
+		with data.whitelist as ["GET:/health$"]
+		with data.roles as {"anonymous": []}
+}
@@ -0,0 +1,10 @@
+// Package policies expone las políticas del repositorio para incluirlas en el
+// binario con opa.Config{FS: policies.Authz, PoliciesPath: "authz"}.
+package policies
+
+import "embed"
+
+// Authz contiene authz/*.rego y sus datos (roles, permisos y whitelist).
+//
+//go:embed authz
+var Authz embed.FS
@@ -0,0 +1,26 @@
+package policies
+
+import (
+	"context"
+	"testing"
+
+	"github.com/open-policy-agent/opa/v1/tester"
+)
+
+// TestRego ejecuta los tests de rego (opa test .) con go test.
+func TestRego(t *testing.T) {
+	results, err := tester.Run(context.Background(), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) == 0 {
+		t.Fatal("no se encontraron tests de rego")
+	}
+	for _, r := range results {
+		if r.Error != nil {
+			t.Errorf("%s: %v", r.Name, r.Error)
+		} else if !r.Pass() {
+			t.Errorf("%s: falló", r.Name)
+		}
+	}
+}